@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to filename so that, even if JTT crashes or the machine loses power,
+// the file holds either its old contents or all of the new ones.
+// Data goes to a temporary file in the same directory, which is synced and then renamed into place.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	// Hidden, and with a suffix, so it never looks like a snapshot
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	// Only does anything if we fail before the rename
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("failed to move temporary file into place: %w", err)
+	}
+	// Sync the directory too, so the rename itself survives a crash.
+	// Not every platform supports this, and the data is already safe, so errors are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "a-2024-07-16.json")
+	for _, contents := range []string{"first", "second"} {
+		if err := writeFileAtomic(filename, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Fatalf("unexpected contents. Got %q, want %q", data, contents)
+		}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected permissions: %v", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected no temporary files left behind. Got %d files", len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	if err := writeFileAtomic(path.Join(t.TempDir(), "missing", "a.json"), []byte("x"), 0644); err == nil {
+		t.Fatal("expected error writing to a missing directory")
+	}
+}
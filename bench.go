@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// LabelledCaptcha is a captcha image with a known solution.
+type LabelledCaptcha struct {
+	Label string
+	Path  string
+	// The image as a data URL, the way JailTracker sends it
+	InlineImage string
+}
+
+// LoadLabelledCaptchas reads every image in dir, taking the label from the file name:
+// everything before the first "_", or the whole name without its extension.
+// This is the layout written by `jtt captcha-corpus export`.
+func LoadLabelledCaptchas(dir string) ([]LabelledCaptcha, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list captcha directory: %w", err)
+	}
+	var captchas []LabelledCaptcha
+	for _, f := range files {
+		name := f.Name()
+		ext := path.Ext(name)
+		mimeType := mime.TypeByExtension(ext)
+		if f.IsDir() || !strings.HasPrefix(mimeType, "image/") {
+			continue
+		}
+		label, _, _ := strings.Cut(strings.TrimSuffix(name, ext), "_")
+		data, err := os.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read captcha image: %w", err)
+		}
+		captchas = append(captchas, LabelledCaptcha{
+			Label:       label,
+			Path:        path.Join(dir, name),
+			InlineImage: fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)),
+		})
+	}
+	return captchas, nil
+}
+
+// BenchReport summarizes a solver's performance over a set of labelled captchas.
+type BenchReport struct {
+	Total int
+	// Solutions identical to the label
+	Exact int
+	// Solutions matching the label apart from case
+	ExactIgnoringCase int
+	// Solutions that solutionFormatIsValid would have rejected before submission
+	FormatInvalid int
+	// Captchas the solver returned an error for
+	Errors int
+	// Time taken by each call to Solve
+	Latencies []time.Duration
+	// Counts of solved character by expected character, for solutions of the right length
+	Confusion map[rune]map[rune]int
+
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+}
+
+// BenchSolver runs the solver over every captcha.
+func BenchSolver(solver CaptchaSolver, captchas []LabelledCaptcha) *BenchReport {
+	report := &BenchReport{
+		Confusion: map[rune]map[rune]int{},
+	}
+	for _, captcha := range captchas {
+		report.Total++
+		start := time.Now()
+		guess, err := solver.Solve(context.Background(), captcha.InlineImage)
+		report.Latencies = append(report.Latencies, time.Since(start))
+		if err != nil {
+			report.Errors++
+			continue
+		}
+		report.PromptTokens += guess.PromptTokens
+		report.CompletionTokens += guess.CompletionTokens
+		report.CostUSD += guess.CostUSD
+		if !solutionFormatIsValid(guess.Text) {
+			report.FormatInvalid++
+		}
+		if guess.Text == captcha.Label {
+			report.Exact++
+		}
+		if strings.EqualFold(guess.Text, captcha.Label) {
+			report.ExactIgnoringCase++
+		}
+		want, got := []rune(captcha.Label), []rune(guess.Text)
+		if len(want) != len(got) {
+			continue
+		}
+		for i := range want {
+			if report.Confusion[want[i]] == nil {
+				report.Confusion[want[i]] = map[rune]int{}
+			}
+			report.Confusion[want[i]][got[i]]++
+		}
+	}
+	return report
+}
+
+// LatencyPercentile returns the latency at percentile p (0-100), or 0 if nothing was run.
+func (r *BenchReport) LatencyPercentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(r.Latencies))
+	copy(sorted, r.Latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// confusionPair is a character solved as another character.
+type confusionPair struct {
+	Want, Got rune
+	Count     int
+}
+
+// Mistakes lists characters solved incorrectly, most frequent first.
+func (r *BenchReport) Mistakes() []confusionPair {
+	var pairs []confusionPair
+	for want, gots := range r.Confusion {
+		for got, count := range gots {
+			if want != got {
+				pairs = append(pairs, confusionPair{want, got, count})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Count != pairs[j].Count {
+			return pairs[i].Count > pairs[j].Count
+		}
+		if pairs[i].Want != pairs[j].Want {
+			return pairs[i].Want < pairs[j].Want
+		}
+		return pairs[i].Got < pairs[j].Got
+	})
+	return pairs
+}
+
+// Print writes a human-readable summary, with at most maxMistakes rows of character confusions.
+func (r *BenchReport) Print(w io.Writer, maxMistakes int) error {
+	percent := func(n int) float64 {
+		if r.Total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(r.Total)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Captchas\t%d\n", r.Total)
+	fmt.Fprintf(tw, "Exact match\t%d\t%.1f%%\n", r.Exact, percent(r.Exact))
+	fmt.Fprintf(tw, "Match ignoring case\t%d\t%.1f%%\n", r.ExactIgnoringCase, percent(r.ExactIgnoringCase))
+	fmt.Fprintf(tw, "Invalid format\t%d\t%.1f%%\n", r.FormatInvalid, percent(r.FormatInvalid))
+	fmt.Fprintf(tw, "Errors\t%d\t%.1f%%\n", r.Errors, percent(r.Errors))
+	fmt.Fprintf(tw, "Latency p50/p90/p99\t%v / %v / %v\n",
+		r.LatencyPercentile(50), r.LatencyPercentile(90), r.LatencyPercentile(99))
+	fmt.Fprintf(tw, "Tokens (prompt/completion)\t%d / %d\n", r.PromptTokens, r.CompletionTokens)
+	fmt.Fprintf(tw, "Estimated cost\t$%.4f\n", r.CostUSD)
+	if r.Total > 0 {
+		fmt.Fprintf(tw, "Estimated cost per 1000\t$%.2f\n", 1000*r.CostUSD/float64(r.Total))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	mistakes := r.Mistakes()
+	if len(mistakes) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nMost common character mistakes:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WANT\tGOT\tCOUNT")
+	for i, m := range mistakes {
+		if i == maxMistakes {
+			break
+		}
+		fmt.Fprintf(tw, "%c\t%c\t%d\n", m.Want, m.Got, m.Count)
+	}
+	return tw.Flush()
+}
+
+// runBenchSolver implements `jtt bench-solver`.
+func runBenchSolver(args []string) error {
+	flags := flag.NewFlagSet("bench-solver", flag.ContinueOnError)
+	solverName := flags.String("solver", appConfig.SolverName(nil), "name of the solver to benchmark")
+	dir := flags.String("dir", "captcha-export", "directory of labelled captcha images, named <label>_*.gif")
+	limit := flags.Int("limit", 0, "benchmark at most this many captchas (0 for all)")
+	mistakes := flags.Int("mistakes", 20, "number of character mistakes to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if appConfig.solverNeedsOpenAIKey(*solverName, 0) && appEnv.OpenAIAPIKey == "" {
+		return errors.New("JTT_OPENAI_API_KEY must be set")
+	}
+	solver, err := appConfig.NewSolver(*solverName)
+	if err != nil {
+		return err
+	}
+	captchas, err := LoadLabelledCaptchas(*dir)
+	if err != nil {
+		return err
+	}
+	if len(captchas) == 0 {
+		return fmt.Errorf("no captcha images found in %s", *dir)
+	}
+	if *limit > 0 && *limit < len(captchas) {
+		captchas = captchas[:*limit]
+	}
+
+	fmt.Printf("Benchmarking solver \"%s\" on %d captchas from %s\n\n", *solverName, len(captchas), *dir)
+	report := BenchSolver(solver, captchas)
+	return report.Print(os.Stdout, *mistakes)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+)
+
+// mapSolver answers with a fixed solution per image.
+type mapSolver map[string]string
+
+func (m mapSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	return &CaptchaGuess{Text: m[inlineImage], Confidence: 1, Solver: "map", CostUSD: 0.01}, nil
+}
+
+func TestLoadLabelledCaptchas(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a1B2_0123abcd.gif", "XK7p.gif", "notes.txt"} {
+		if err := os.WriteFile(path.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	captchas, err := LoadLabelledCaptchas(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(captchas) != 2 {
+		t.Fatalf("unexpected captcha count. Got %d, want 2", len(captchas))
+	}
+	labels := map[string]bool{}
+	for _, c := range captchas {
+		labels[c.Label] = true
+	}
+	if !labels["a1B2"] || !labels["XK7p"] {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+}
+
+func TestBenchSolver(t *testing.T) {
+	captchas := []LabelledCaptcha{
+		{Label: "a1B2", InlineImage: "one"},
+		{Label: "XK7p", InlineImage: "two"},
+		{Label: "0m9Z", InlineImage: "three"},
+		{Label: "abcd", InlineImage: "four"},
+	}
+	solver := mapSolver{
+		"one":   "a1B2",  // Exact
+		"two":   "xk7p",  // Wrong case
+		"three": "Om9Z",  // O for 0
+		"four":  "ab cd", // Invalid format
+	}
+	report := BenchSolver(solver, captchas)
+	if report.Total != 4 || report.Exact != 1 || report.ExactIgnoringCase != 2 || report.FormatInvalid != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Confusion['0']['O'] != 1 || report.Confusion['X']['x'] != 1 || report.Confusion['a']['a'] != 1 {
+		t.Fatalf("unexpected confusion: %v", report.Confusion)
+	}
+	mistakes := report.Mistakes()
+	if len(mistakes) != 3 {
+		t.Fatalf("unexpected mistakes: %v", mistakes)
+	}
+	if len(report.Latencies) != 4 || report.LatencyPercentile(99) < report.LatencyPercentile(50) {
+		t.Fatalf("unexpected latencies: %v", report.Latencies)
+	}
+	if report.CostUSD < 0.0399 || report.CostUSD > 0.0401 {
+		t.Fatalf("unexpected cost. Got %f, want 0.04", report.CostUSD)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Snapshots are grouped by the UTC day their crawl started, in this format
+const cacheDateFormat = "2006-01-02"
+
+// CacheMode decides when LoadJailCached uses a cached snapshot rather than crawling.
+type CacheMode string
+
+const (
+	// Use the latest snapshot if it's fresh, resuming it if incomplete. Otherwise crawl.
+	CacheFresh CacheMode = "fresh"
+	// Always crawl, replacing any snapshot from the same day
+	CacheRefresh CacheMode = "refresh"
+	// Never crawl or resume. Use the latest snapshot however old or incomplete, and fail if there's none.
+	CacheOnly CacheMode = "cache-only"
+	// Like CacheFresh, but crawl incomplete snapshots again from scratch instead of resuming them
+	CacheRefreshIncomplete CacheMode = "refresh-if-incomplete"
+)
+
+var cacheModes = []CacheMode{CacheFresh, CacheRefresh, CacheOnly, CacheRefreshIncomplete}
+
+// parseCacheMode checks a cache mode from the config or command line. Empty means CacheFresh.
+func parseCacheMode(s string) (CacheMode, error) {
+	if s == "" {
+		return CacheFresh, nil
+	}
+	for _, mode := range cacheModes {
+		if CacheMode(s) == mode {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf(`unknown cache mode "%s"; expected one of %v`, s, cacheModes)
+}
+
+// CachePolicy is a cache mode, along with how old a snapshot may be and still count as fresh.
+type CachePolicy struct {
+	Mode CacheMode
+	// With zero, only a snapshot started on the current UTC day is fresh.
+	MaxAge time.Duration
+}
+
+// IsFresh returns whether a snapshot is recent enough to use instead of crawling.
+func (p CachePolicy) IsFresh(jail *Jail, now time.Time) bool {
+	if p.MaxAge > 0 {
+		return now.Sub(jail.StartTimeUTC) <= p.MaxAge
+	}
+	return jail.StartTimeUTC.UTC().Format(cacheDateFormat) == now.UTC().Format(cacheDateFormat)
+}
+
+// What LoadJailCached will do with a jail
+type cacheAction int
+
+const (
+	cacheCrawl cacheAction = iota
+	cacheResume
+	cacheUse
+	// Nothing to use, and not allowed to crawl
+	cacheMiss
+)
+
+// decide returns what to do given the latest snapshot, which is nil if there isn't one, and why.
+func (p CachePolicy) decide(jail *Jail, now time.Time) (cacheAction, string) {
+	switch {
+	case p.Mode == CacheRefresh:
+		return cacheCrawl, "refresh requested"
+	case jail == nil && p.Mode == CacheOnly:
+		return cacheMiss, "no snapshot cached"
+	case jail == nil:
+		return cacheCrawl, "no snapshot cached"
+	case p.Mode == CacheOnly:
+		return cacheUse, "cache only"
+	case !p.IsFresh(jail, now):
+		return cacheCrawl, fmt.Sprintf("snapshot from %s is stale", jail.StartTimeUTC.Format(time.RFC3339))
+	case jail.Incomplete && p.Mode == CacheRefreshIncomplete:
+		return cacheCrawl, "previous crawl incomplete"
+	case jail.Incomplete:
+		return cacheResume, "previous crawl incomplete"
+	case jail.failedFetches() > 0:
+		// Finished, but some inmates' details couldn't be fetched. Resuming tries just those again.
+		return cacheResume, fmt.Sprintf("%d inmates' details failed", jail.failedFetches())
+	default:
+		return cacheUse, "snapshot is fresh"
+	}
+}
+
+// CachePolicy returns the configured cache policy.
+// An unknown CacheMode is an error rather than falling back to fresh, since a misspelled cache-only must never crawl.
+func (config *AppConfig) CachePolicy() (CachePolicy, error) {
+	mode, err := parseCacheMode(config.CacheMode)
+	if err != nil {
+		return CachePolicy{}, err
+	}
+	return CachePolicy{
+		Mode:   mode,
+		MaxAge: time.Duration(config.CacheMaxAgeHours) * time.Hour,
+	}, nil
+}
+
+// LoadJailCached loads the latest snapshot of a jail from the store, crawls it anew, or resumes an incomplete crawl,
+// as the cache policy decides. A new crawl is saved to the store.
+// Progress is saved every appConfig.CheckpointInterval() inmates.
+// If the crawl is cut short by ctx, the partial jail is still saved, marked Incomplete, and the error returned.
+func LoadJailCached(ctx context.Context, store SnapshotStore, jailConfig *JailConfig, policy CachePolicy) (*Jail, error) {
+	logger := jailLogger(jailConfig.Slug)
+	// Amounts, sentences and timestamps are parsed before every save, and in snapshots loaded as they are
+	loc, err := jailConfig.Location()
+	if err != nil {
+		logger.Printf("Not parsing timestamps: %v", err)
+	}
+	save := func(jail *Jail) error {
+		jail.Parse(loc)
+		return store.Save(jail)
+	}
+	var jail *Jail
+	var location string
+	if policy.Mode != CacheRefresh {
+		jail, location, err = latestValidJail(store, jailConfig.Slug, logger)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	action, reason := policy.decide(jail, time.Now())
+	switch action {
+	case cacheMiss:
+		return nil, fmt.Errorf("%s in %s, and cache mode is %s", reason, store, policy.Mode)
+	case cacheUse:
+		logger.Printf("Loaded jail data from \"%s\"", location)
+		jail.cached = true
+		jail.Parse(loc)
+		return jail, nil
+	case cacheResume:
+		logger.Printf("Cached data in \"%s\" is incomplete; resuming crawl. See %s", location, jailConfig.IndexURL)
+		solver, err := appConfig.NewSolver(appConfig.SolverName(jailConfig))
+		if err != nil {
+			return nil, err
+		}
+		err = ResumeJail(ctx, jail, solver, save, appConfig.CheckpointInterval())
+		return jail, saveCrawl(save, jail, err)
+	}
+
+	logger.Printf("Crawling jail (%s). See %s", reason, jailConfig.IndexURL)
+	solver, err := appConfig.NewSolver(appConfig.SolverName(jailConfig))
+	if err != nil {
+		return nil, err
+	}
+	jail, err = CrawlJail(ctx, jailConfig.BaseURL, jailConfig.Slug, solver, save, appConfig.CheckpointInterval())
+	if jail == nil {
+		return nil, err
+	}
+	return jail, saveCrawl(save, jail, err)
+}
+
+// latestValidJail is store.Latest, but quarantines corrupt snapshots instead of failing, if the store can,
+// falling back to the latest one that isn't corrupt.
+func latestValidJail(store SnapshotStore, jailName string, logger *log.Logger) (*Jail, string, error) {
+	q, canQuarantine := store.(quarantiner)
+	for {
+		jail, location, err := store.Latest(jailName)
+		if !errors.Is(err, errCorruptSnapshot) || !canQuarantine {
+			return jail, location, err
+		}
+		logger.Printf("Ignoring %v", err)
+		quarantined, qErr := q.Quarantine(location)
+		if qErr != nil {
+			return nil, "", errors.Join(err, qErr)
+		}
+		logger.Printf("Moved corrupt snapshot to \"%s\"", quarantined)
+	}
+}
+
+// saveCrawl saves a jail after crawling it, whether or not the crawl finished, returning crawlErr if it didn't.
+func saveCrawl(save func(*Jail) error, jail *Jail, crawlErr error) error {
+	if err := save(jail); err != nil {
+		return errors.Join(crawlErr, err)
+	}
+	if jail.Incomplete {
+		jail.logf("Saved partial jail data")
+	}
+	return crawlErr
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachePolicyDecide(t *testing.T) {
+	now := time.Date(2024, 7, 16, 1, 0, 0, 0, time.UTC)
+	today := &Jail{StartTimeUTC: now.Add(-30 * time.Minute)}
+	// Yesterday in UTC, though it may be today in US time zones
+	lateYesterday := &Jail{StartTimeUTC: now.Add(-2 * time.Hour)}
+	incomplete := &Jail{StartTimeUTC: now.Add(-30 * time.Minute), Incomplete: true}
+	withFailures := &Jail{StartTimeUTC: now.Add(-30 * time.Minute), Inmates: []Inmate{
+		{Fetch: InmateFetch{Status: FetchOK}},
+		{Fetch: InmateFetch{Status: FetchFailed}},
+	}}
+	staleWithFailures := &Jail{StartTimeUTC: now.Add(-48 * time.Hour), Inmates: withFailures.Inmates}
+	tests := []struct {
+		Name   string
+		Policy CachePolicy
+		Jail   *Jail
+		Want   cacheAction
+	}{
+		{"fresh, none cached", CachePolicy{Mode: CacheFresh}, nil, cacheCrawl},
+		{"fresh, today", CachePolicy{Mode: CacheFresh}, today, cacheUse},
+		{"fresh, yesterday UTC", CachePolicy{Mode: CacheFresh}, lateYesterday, cacheCrawl},
+		{"fresh with max age", CachePolicy{Mode: CacheFresh, MaxAge: 6 * time.Hour}, lateYesterday, cacheUse},
+		{"fresh, too old for max age", CachePolicy{Mode: CacheFresh, MaxAge: time.Hour}, lateYesterday, cacheCrawl},
+		{"fresh, incomplete", CachePolicy{Mode: CacheFresh}, incomplete, cacheResume},
+		{"refresh", CachePolicy{Mode: CacheRefresh}, today, cacheCrawl},
+		{"cache only, none cached", CachePolicy{Mode: CacheOnly}, nil, cacheMiss},
+		{"cache only, stale", CachePolicy{Mode: CacheOnly}, lateYesterday, cacheUse},
+		{"cache only, incomplete", CachePolicy{Mode: CacheOnly}, incomplete, cacheUse},
+		{"refresh if incomplete, complete", CachePolicy{Mode: CacheRefreshIncomplete}, today, cacheUse},
+		{"refresh if incomplete, incomplete", CachePolicy{Mode: CacheRefreshIncomplete}, incomplete, cacheCrawl},
+		{"fresh, failed fetches", CachePolicy{Mode: CacheFresh}, withFailures, cacheResume},
+		{"refresh if incomplete, failed fetches", CachePolicy{Mode: CacheRefreshIncomplete}, withFailures, cacheResume},
+		{"fresh, stale with failed fetches", CachePolicy{Mode: CacheFresh}, staleWithFailures, cacheCrawl},
+		{"cache only, failed fetches", CachePolicy{Mode: CacheOnly}, withFailures, cacheUse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			got, reason := tt.Policy.decide(tt.Jail, now)
+			if got != tt.Want {
+				t.Fatalf("unexpected action (%s). Got %d, want %d", reason, got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestParseCacheMode(t *testing.T) {
+	if mode, err := parseCacheMode(""); err != nil || mode != CacheFresh {
+		t.Fatalf("expected empty mode to mean fresh. Got %q, %v", mode, err)
+	}
+	if mode, err := parseCacheMode("cache-only"); err != nil || mode != CacheOnly {
+		t.Fatalf("unexpected mode. Got %q, %v", mode, err)
+	}
+	if _, err := parseCacheMode("sometimes"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func TestCachePolicyRejectsUnknownMode(t *testing.T) {
+	// A misspelled cache-only mustn't quietly crawl as fresh
+	config := &AppConfig{CacheMode: "cache_only"}
+	if _, err := config.CachePolicy(); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	config.CacheMode = "cache-only"
+	if policy, err := config.CachePolicy(); err != nil || policy.Mode != CacheOnly {
+		t.Fatalf("unexpected policy. Got %+v, %v", policy, err)
+	}
+
+	oldMode := appConfig.CacheMode
+	appConfig.CacheMode = "cache_only"
+	defer func() { appConfig.CacheMode = oldMode }()
+	if err := runCrawl([]string{"-dry-run"}); err == nil {
+		t.Fatal("expected crawl to fail with an unknown cache mode")
+	}
+}
+
+func TestCrawlCacheOnlyNeedsNoOpenAIKey(t *testing.T) {
+	defer func(config AppConfig, env AppEnv) { *appConfig, *appEnv = config, env }(*appConfig, *appEnv)
+	*appEnv = AppEnv{}
+	*appConfig = AppConfig{
+		Jails: []JailConfig{{Slug: "a", State: "MS", Usable: true}},
+		Cache: t.TempDir(),
+	}
+	store := &JSONStore{Dir: appConfig.Cache}
+	if err := store.Save(&Jail{Name: "a", StartTimeUTC: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCrawl(nil); err == nil || !strings.Contains(err.Error(), "JTT_OPENAI_API_KEY") {
+		t.Fatalf("expected a crawl with the default solver to need a key. Got %v", err)
+	}
+	if err := runCrawl([]string{"-cache-mode", "cache-only"}); err != nil {
+		t.Fatalf("expected cache-only to run without a key. Got %v", err)
+	}
+}
+
+func TestLoadJailCachedCacheOnly(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+
+	// No BaseURL, so any request would fail
+	jailConfig := &JailConfig{Slug: "a", Usable: true}
+	policy := CachePolicy{Mode: CacheOnly}
+	if _, err := LoadJailCached(context.Background(), store, jailConfig, policy); err == nil {
+		t.Fatal("expected error with nothing cached")
+	}
+	stale := &Jail{Name: "a", StartTimeUTC: time.Now().Add(-72 * time.Hour), Incomplete: true}
+	if err := store.Save(stale); err != nil {
+		t.Fatal(err)
+	}
+	jail, err := LoadJailCached(context.Background(), store, jailConfig, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jail.cached || !jail.Incomplete {
+		t.Fatalf("expected the stale, incomplete snapshot as is. Got %+v", jail)
+	}
+}
+
+func TestCorruptSnapshotsAreQuarantined(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+
+	older := &Jail{Name: "a", StartTimeUTC: time.Now().Add(-48 * time.Hour)}
+	if err := store.Save(older); err != nil {
+		t.Fatal(err)
+	}
+	// A write cut short, and a file that's valid JSON but not a snapshot
+	truncated := store.pathFor("a", time.Now(), CompressionNone)
+	if err := os.WriteFile(truncated, []byte(`{"Name": "a", "Offend`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := store.pathFor("a", time.Now().Add(-24*time.Hour), CompressionNone)
+	if err := os.WriteFile(empty, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readCachedJail(truncated); !errors.Is(err, errCorruptSnapshot) {
+		t.Fatalf("expected truncated snapshot to be corrupt. Got %v", err)
+	}
+	if _, err := readCachedJail(empty); !errors.Is(err, errCorruptSnapshot) {
+		t.Fatalf("expected empty snapshot to be corrupt. Got %v", err)
+	}
+
+	// Cache only, so the stale snapshot is used rather than crawled
+	jail, err := LoadJailCached(context.Background(), store, &JailConfig{Slug: "a"}, CachePolicy{Mode: CacheOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jail.StartTimeUTC.Equal(older.StartTimeUTC) {
+		t.Fatalf("expected the older, valid snapshot. Got one from %v", jail.StartTimeUTC)
+	}
+	for _, filename := range []string{truncated, empty} {
+		if _, err := os.Stat(filename); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be moved away. Got %v", filename, err)
+		}
+	}
+	quarantined, err := os.ReadDir(path.Join(store.Dir, quarantineDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 {
+		t.Fatalf("expected 2 quarantined snapshots. Got %d", len(quarantined))
+	}
+}
+
+func TestLoadJailCachedRetriesFailedFetches(t *testing.T) {
+	var fetched []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jtclientweb/Offender/a/", func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.Path)
+		w.Write([]byte(`{"succes":true,"offenderViewKey":7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Today's crawl finished, but one inmate's details failed
+	store := &JSONStore{Dir: t.TempDir()}
+	snapshot := &Jail{
+		BaseURL:         server.URL,
+		Name:            "a",
+		StartTimeUTC:    time.Now().UTC(),
+		OffenderViewKey: 7,
+		Inmates: []Inmate{
+			{ArrestNo: "A1", Fetch: InmateFetch{Status: FetchOK}},
+			{ArrestNo: "A2", Fetch: InmateFetch{Status: FetchFailed, Attempts: 1, LastError: "timeout"}},
+		},
+	}
+	if err := store.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	jailConfig := &JailConfig{Slug: "a", State: "MS", Solver: "local", Usable: true}
+	jail, err := LoadJailCached(context.Background(), store, jailConfig, CachePolicy{Mode: CacheFresh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 1 || fetched[0] != "/jtclientweb/Offender/a/A2/offenderbucket/7" {
+		t.Fatalf("expected only the failed inmate fetched again. Got %v", fetched)
+	}
+	if jail.cached || jail.failedFetches() != 0 {
+		t.Fatalf("expected the failed inmate fetched. Got %+v", jail.Inmates)
+	}
+	saved, _, err := store.Latest("a")
+	if err != nil || saved.failedFetches() != 0 {
+		t.Fatalf("expected the retried snapshot saved. Got %+v, %v", saved, err)
+	}
+}
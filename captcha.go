@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"net/url"
 	"regexp"
 )
@@ -14,6 +14,9 @@ const (
 
 var solutionPattern = regexp.MustCompile(`^[a-zA-Z0-9]{4}$`)
 
+// Wraps errors from the captcha solver, which may be a *RequestError from a solver API rather than JailTracker
+var errSolverFailed = errors.New("failed to get captcha solution")
+
 // Response from GET GET_CAPTCHA_CLIENT_URL and request to POST VALIDATE_CAPTCHA_URL
 // Format: {"captchaKey":"BASE64","captchaImage":"data:image/gif;base64,...BASE64...","userCode":null}
 type CaptchaProtocol struct {
@@ -31,8 +34,40 @@ type CaptchaAttemptResults struct {
 	CaptchaKey     string `json:"captchaKey"`
 }
 
+// CaptchaStats counts what happened to the captchas fetched during a crawl, and what solving them cost.
+// Every fetched captcha ends up in exactly one of SolverErrors, RejectedFormat, RejectedServer or Accepted,
+// unless the validation request itself failed.
+type CaptchaStats struct {
+	// Captchas fetched from JailTracker
+	Fetched int
+	// Captchas the solver returned an answer for
+	Solved int
+	// Captchas the solver failed on
+	SolverErrors int
+	// Answers not submitted because they failed solutionFormatIsValid
+	RejectedFormat int
+	// Answers JailTracker said didn't match
+	RejectedServer int
+	// Answers JailTracker accepted
+	Accepted int
+
+	// Tokens billed by paid solvers, and the estimated cost in US dollars
+	PromptTokens     int
+	CompletionTokens int
+	EstimatedCostUSD float64
+}
+
+// addGuess counts a solver's answer and what it cost.
+func (s *CaptchaStats) addGuess(guess *CaptchaGuess) {
+	s.Solved++
+	s.PromptTokens += guess.PromptTokens
+	s.CompletionTokens += guess.CompletionTokens
+	s.EstimatedCostUSD += guess.CostUSD
+}
+
 // ProcessCaptcha retrieves and solves the captcha for the given jail, returning the captchaKey.
-func ProcessCaptcha(jail *Jail) (string, error) {
+// The outcome is counted in jail.CaptchaStats.
+func ProcessCaptcha(ctx context.Context, jail *Jail) (string, error) {
 	// Referer should be the jail's URL; used for redirection in web client.
 	// May not affect us, but matches "normal" traffic.
 	headers := map[string][]string{
@@ -52,33 +87,58 @@ func ProcessCaptcha(jail *Jail) (string, error) {
 
 	// Get the captcha key
 	challenge := &CaptchaProtocol{}
-	err = GetJSON[CaptchaProtocol](getCaptchaClientURL, headers, challenge)
+	err = GetJSON[CaptchaProtocol](ctx, getCaptchaClientURL, headers, challenge)
 	if err != nil {
 		return "", fmt.Errorf("failed to GET captcha key: %w", err)
 	}
+	stats := &jail.CaptchaStats
+	stats.Fetched++
 
 	// Solve captcha
-	solution, err := solveCaptchaOpenAI(challenge.CaptchaImage)
+	if jail.solver == nil {
+		return "", errors.New("no captcha solver configured for jail")
+	}
+	guess, err := jail.solver.Solve(ctx, challenge.CaptchaImage)
 	if err != nil {
-		return "", fmt.Errorf("failed to get captcha solution: %w", err)
+		stats.SolverErrors++
+		return "", fmt.Errorf("%w: %w", errSolverFailed, err)
 	}
+	stats.addGuess(guess)
+	solution := guess.Text
 	challenge.UserCode = solution
-	log.Printf("Received solution: %s", solution)
-	if !solutionFormatIsValid(solution) {
+	jail.logf("Received solution: %s", solution)
+	attempt := CorpusEntry{
+		Jail:        jail.Name,
+		Solver:      guess.Solver,
+		Solution:    solution,
+		Confidence:  guess.Confidence,
+		FormatValid: solutionFormatIsValid(solution),
+	}
+	if !attempt.FormatValid {
+		stats.RejectedFormat++
+		recordCaptcha(challenge.CaptchaImage, attempt)
 		return "", fmt.Errorf(`solution "%s" seems invalid; skipping`, solution)
 	}
 
 	// Submit response
 	results := &CaptchaAttemptResults{}
-	err = PostJSON[CaptchaProtocol, CaptchaAttemptResults](validateCaptchaURL, headers, challenge, results)
+	// Each answer is checked once: a repeated validation could count against us, or against a captcha already accepted
+	err = PostJSONOnce[CaptchaProtocol, CaptchaAttemptResults](ctx, validateCaptchaURL, headers, challenge, results)
 	if err != nil {
 		return "", fmt.Errorf("failed to submit captcha solution: %w", err)
 	}
+	attempt.Matched = results.CaptchaMatched
+	recordCaptcha(challenge.CaptchaImage, attempt)
+	if feedback, ok := jail.solver.(CaptchaFeedback); ok {
+		feedback.Verdict(guess, results.CaptchaMatched)
+	}
 	if !results.CaptchaMatched {
+		stats.RejectedServer++
 		return "", errors.New("captcha did not match")
 	}
+	stats.Accepted++
 
-	log.Printf("Solution \"%s\" matched key \"%s\"", solution, results.CaptchaKey)
+	jail.logf("Solution \"%s\" matched key \"%s\"", solution, results.CaptchaKey)
 
 	return results.CaptchaKey, nil
 }
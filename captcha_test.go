@@ -1,8 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -30,9 +31,6 @@ func TestProcessCaptcha(t *testing.T) {
 	getCaptchaResponse := []byte(`{"captchaKey":"TEST_KEY","captchaImage":"TEST_IMAGE","userCode":null}`)
 	// Solution server expects
 	captchaSolution := "a1B2"
-	// Solution returned by solver
-	solverResponseTemplate := `{"choices":[{"message":{"content":"%s"}}]}`
-	solverResponse := []byte(fmt.Sprintf(solverResponseTemplate, captchaSolution))
 	// Simulate validation success
 	var validateCaptchaSuccess bool
 
@@ -76,19 +74,13 @@ func TestProcessCaptcha(t *testing.T) {
 	mockJTServer := httptest.NewServer(mux)
 	defer mockJTServer.Close()
 
-	// Mock OpenAI
-	mockOpenAIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(solverResponse)
-	}))
-	defer mockOpenAIServer.Close()
-	// Point solver at our mock
-	OpenAICompletionsURL = mockOpenAIServer.URL
+	// Stub solver; its answer is set per case
+	solver := &stubSolver{}
 
 	jail := &Jail{
 		BaseURL: mockJTServer.URL,
 		Name:    "test",
+		solver:  solver,
 	}
 
 	cases := []struct {
@@ -126,7 +118,6 @@ func TestProcessCaptcha(t *testing.T) {
 		},
 		// Can extend cases to test other failure modes:
 		//   Test failure to get captcha key
-		//   Test failure to solve captcha
 		//   Test failure to submit solution
 		//   Test failure to match captcha
 		// Jail.updateCaptcha should be tested as well for retry behavior.
@@ -135,11 +126,11 @@ func TestProcessCaptcha(t *testing.T) {
 		t.Run(c.Label, func(t *testing.T) {
 			// Set up the mock responses
 			validateCaptchaSuccess = c.ValidateCaptchaSuccess
-			solverResponse = []byte(fmt.Sprintf(solverResponseTemplate, c.Solution))
+			solver.Text = c.Solution
 			// Reset the expected solution
 			captchaSolution = c.ExpectedSolution
 
-			got, err := ProcessCaptcha(jail)
+			got, err := ProcessCaptcha(context.Background(), jail)
 			if c.WantErr {
 				if err == nil {
 					t.Fatal("expected error, got nil")
@@ -154,6 +145,51 @@ func TestProcessCaptcha(t *testing.T) {
 			}
 		})
 	}
+
+	// One of each outcome across the cases above
+	want := CaptchaStats{Fetched: 3, Solved: 3, RejectedFormat: 1, RejectedServer: 1, Accepted: 1}
+	if jail.CaptchaStats != want {
+		t.Fatalf("unexpected captcha stats. Got %+v, want %+v", jail.CaptchaStats, want)
+	}
+}
+
+// stubSolver always answers with Text, or fails with Err if set.
+type stubSolver struct {
+	Text string
+	Err  error
+}
+
+func (s *stubSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return &CaptchaGuess{Text: s.Text, Confidence: 1, Solver: "stub"}, nil
+}
+
+func TestProcessCaptchaSolverFailure(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/jtclientweb/captcha/getnewcaptchaclient", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"captchaKey":"TEST_KEY","captchaImage":"TEST_IMAGE","userCode":null}`))
+	}))
+	mux.Handle("/jtclientweb/Captcha/validatecaptcha", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("solution should not be submitted when the solver fails")
+	}))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	jail := &Jail{
+		BaseURL: ts.URL,
+		Name:    "test",
+		solver:  &stubSolver{Err: errors.New("solver is down")},
+	}
+	_, err := ProcessCaptcha(context.Background(), jail)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if jail.CaptchaStats.Fetched != 1 || jail.CaptchaStats.SolverErrors != 1 {
+		t.Fatalf("unexpected captcha stats: %+v", jail.CaptchaStats)
+	}
 }
 
 func TestProcessCaptchaBadURL(t *testing.T) {
@@ -162,7 +198,7 @@ func TestProcessCaptchaBadURL(t *testing.T) {
 		BaseURL: "Bad URL with spaces",
 		Name:    "Doesn't matter",
 	}
-	_, err := ProcessCaptcha(j)
+	_, err := ProcessCaptcha(context.Background(), j)
 	if err == nil {
 		t.Fatal("expected error, got nil for bad URL")
 	}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Subcommands, by name. With no subcommand, JTT runs crawl.
+var commands = map[string]func(args []string) error{
+	"crawl":           runCrawl,
+	"list-jails":      runListJails,
+	"show":            runShow,
+	"export":          runExport,
+	"validate-config": runValidateConfig,
+	"probe":           runProbe,
+	"compact":         runCompact,
+	"migrate-cache":   runMigrateCache,
+	"sync":            runSync,
+	"bench-solver":    runBenchSolver,
+	"captcha-corpus":  runCaptchaCorpus,
+}
+
+// Listed in this order by `jtt help`
+var commandSummaries = []struct{ Name, Summary string }{
+	{"crawl", "crawl jails into the cache (the default)"},
+	{"list-jails", "list configured jails"},
+	{"show", "summarize a jail's cached snapshot"},
+	{"export", "export cached snapshots as CSV or JSON"},
+	{"validate-config", "check the config file for mistakes"},
+	{"probe", "check that jails can be reached, without crawling inmates"},
+	{"compact", "convert cached snapshots to the configured compression"},
+	{"migrate-cache", "upgrade cached snapshots to the current format"},
+	{"sync", "push cached snapshots to the shared Postgres database"},
+	{"bench-solver", "measure a captcha solver against labelled captchas"},
+	{"captcha-corpus", "list, dedupe or export saved captchas"},
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: jtt [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commandSummaries {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nRun `jtt <command> -h` for a command's flags.")
+}
+
+// stringList is a flag that can be repeated, or given comma-separated values.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+// addCacheFlag lets a command override the cache directory from the config.
+func addCacheFlag(flags *flag.FlagSet) {
+	flags.StringVar(&appConfig.Cache, "cache", appConfig.Cache, "directory to cache jail data")
+}
+
+// addStorageFlag lets a command override the storage backend from the config.
+func addStorageFlag(flags *flag.FlagSet) {
+	flags.StringVar(&appConfig.Storage, "storage", appConfig.Storage, fmt.Sprintf("where snapshots are kept: %s or %s (default from config, or %s)", StorageJSON, StorageSQLite, StorageJSON))
+}
+
+// requireOpenAIKey returns an error if any of the jails' solvers calls the OpenAI API and no key is set.
+func requireOpenAIKey(jailConfigs []*JailConfig) error {
+	if appEnv.OpenAIAPIKey != "" {
+		return nil
+	}
+	for _, jailConfig := range jailConfigs {
+		if appConfig.solverNeedsOpenAIKey(appConfig.SolverName(jailConfig), 0) {
+			return errors.New("JTT_OPENAI_API_KEY must be set")
+		}
+	}
+	return nil
+}
+
+// runListJails implements `jtt list-jails`.
+func runListJails(args []string) error {
+	flags := flag.NewFlagSet("list-jails", flag.ContinueOnError)
+	filter := &JailFilter{}
+	filter.addFlags(flags)
+	usableOnly := flags.Bool("usable", false, "only list usable jails")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	jailConfigs, err := filter.Select(appConfig)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLUG\tSTATE\tUSABLE\tSOLVER\tTAGS\tFACILITY\tNOTES")
+	for _, jailConfig := range jailConfigs {
+		if *usableOnly && !jailConfig.Usable {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\t%s\t%s\n", jailConfig.Slug, jailConfig.State, jailConfig.Usable,
+			appConfig.SolverName(jailConfig), strings.Join(jailConfig.Tags, ","), jailConfig.Facility, jailConfig.Notes)
+	}
+	return tw.Flush()
+}
+
+// runValidateConfig implements `jtt validate-config [path]`.
+// Without a path, it checks the config JTT would use (see JTT_CONFIG_PATH).
+func runValidateConfig(args []string) error {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jtt validate-config [path]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, configPath := appConfig, appEnv.ConfigPath
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+		config = &AppConfig{}
+		if err := config.LoadConfig(configPath); err != nil {
+			return err
+		}
+	}
+
+	problems := config.Validate()
+	if err := appEnv.ValidateRequired(config); err != nil {
+		problems = append(problems, err)
+	}
+	for _, problem := range problems {
+		fmt.Printf("%s: %v\n", configPath, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	usable := 0
+	for _, jailConfig := range config.Jails {
+		if jailConfig.Usable {
+			usable++
+		}
+	}
+	fmt.Printf("%s: OK. %d jails, %d usable\n", configPath, len(config.Jails), usable)
+	return nil
+}
+
+// probeResult is what probing one jail found.
+type probeResult struct {
+	Inmates  int
+	Captchas int
+	Duration time.Duration
+	Err      error
+}
+
+// runProbe implements `jtt probe`, which solves a captcha and lists inmates for each jail,
+// without fetching inmate details or saving anything.
+// Unusable jails are only probed if picked by a filter, to check whether they work now.
+func runProbe(args []string) error {
+	flags := flag.NewFlagSet("probe", flag.ContinueOnError)
+	filter := &JailFilter{}
+	filter.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	selected, err := filter.Select(appConfig)
+	if err != nil {
+		return err
+	}
+	var jailConfigs []*JailConfig
+	for _, jailConfig := range selected {
+		if jailConfig.Usable || !filter.IsEmpty() {
+			jailConfigs = append(jailConfigs, jailConfig)
+		}
+	}
+	if err := requireOpenAIKey(jailConfigs); err != nil {
+		return err
+	}
+	registerRateLimits(appConfig)
+	for _, jailConfig := range jailConfigs {
+		registerRateLimit(jailConfig.BaseURL, appConfig.RateLimitFor(jailConfig))
+	}
+	httpClient.Timeout = appConfig.RequestTimeout()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results := map[*JailConfig]probeResult{}
+	var resultsMu sync.Mutex
+	forEachJail(ctx, jailConfigs, appConfig.WorkerCount(), func(jailConfig *JailConfig) {
+		result := probeJail(ctx, jailConfig)
+		resultsMu.Lock()
+		results[jailConfig] = result
+		resultsMu.Unlock()
+	})
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JAIL\tRESULT\tINMATES\tCAPTCHAS\tDURATION\tERROR")
+	for _, jailConfig := range jailConfigs {
+		result, ok := results[jailConfig]
+		status, errText := "ok", ""
+		switch {
+		case !ok:
+			status = OutcomeNotRun
+		case result.Err != nil:
+			status, errText = "failed", result.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%s\n", jailConfig.Slug, status, result.Inmates, result.Captchas,
+			result.Duration.Round(time.Millisecond), errText)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jails failed", failed, len(jailConfigs))
+	}
+	return nil
+}
+
+// probeJail solves a captcha for the jail and lists its inmates, within the jail's deadline.
+func probeJail(ctx context.Context, jailConfig *JailConfig) probeResult {
+	start := time.Now()
+	solver, err := appConfig.NewSolver(appConfig.SolverName(jailConfig))
+	if err != nil {
+		return probeResult{Err: err}
+	}
+	jailCtx, cancel := context.WithTimeout(ctx, appConfig.JailTimeout(jailConfig))
+	defer cancel()
+	jail, err := NewJail(jailCtx, jailConfig.BaseURL, jailConfig.Slug, solver)
+	result := probeResult{Duration: time.Since(start), Err: err}
+	if jail != nil {
+		result.Inmates = len(jail.Inmates)
+		result.Captchas = jail.CaptchaStats.Fetched
+	}
+	if err != nil {
+		jailLogger(jailConfig.Slug).Printf("Probe failed: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCrawlPlan(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+
+	now := time.Date(2024, 7, 16, 12, 0, 0, 0, time.UTC)
+	incomplete := &Jail{
+		Name:         "partial",
+		StartTimeUTC: now.Add(-time.Hour),
+		Incomplete:   true,
+		Inmates: []Inmate{
+			{Fetch: InmateFetch{Status: FetchOK}},
+			{Fetch: InmateFetch{Status: FetchPending}},
+		},
+	}
+	if err := store.Save(incomplete); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&Jail{Name: "done", StartTimeUTC: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&Jail{Name: "old", StartTimeUTC: now.Add(-48 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := CachePolicy{Mode: CacheFresh}
+	tests := []struct {
+		Slug   string
+		Usable bool
+		Policy CachePolicy
+		Want   string
+	}{
+		{"off", false, fresh, "skip (not usable)"},
+		{"new", true, fresh, "crawl (no snapshot cached)"},
+		{"partial", true, fresh, "resume (1 of 2 inmates left)"},
+		{"partial", true, CachePolicy{Mode: CacheRefreshIncomplete}, "crawl (previous crawl incomplete)"},
+		{"done", true, fresh, "load from cache (snapshot is fresh)"},
+		{"done", true, CachePolicy{Mode: CacheRefresh}, "crawl (refresh requested)"},
+		{"old", true, fresh, "crawl (snapshot from 2024-07-14T12:00:00Z is stale)"},
+		{"old", true, CachePolicy{Mode: CacheOnly}, "load from cache (cache only)"},
+		{"new", true, CachePolicy{Mode: CacheOnly}, "fail (no snapshot cached)"},
+	}
+	for _, tt := range tests {
+		got, _ := crawlPlan(store, &JailConfig{Slug: tt.Slug, Usable: tt.Usable}, tt.Policy, now)
+		if got != tt.Want {
+			t.Errorf("unexpected plan for %s (%s). Got %q, want %q", tt.Slug, tt.Policy.Mode, got, tt.Want)
+		}
+	}
+}
+
+func TestWriteInmatesCSV(t *testing.T) {
+	jail := &Jail{
+		Name: "test",
+		Inmates: []Inmate{{
+			ArrestNo:             "123",
+			OriginalBookDateTime: "6/28/2024T10:22:44",
+			Fetch:                InmateFetch{Status: FetchOK},
+			Charges: []Charge{
+				{ChargeDescription: "TRESPASS"},
+				{ChargeDescription: "CONTEMPT, OF COURT"},
+			},
+		}},
+	}
+	jail.ParseTimes(time.FixedZone("CDT", -5*60*60))
+	var out bytes.Buffer
+	if err := writeInmatesCSV(&out, []*Jail{jail}); err != nil {
+		t.Fatal(err)
+	}
+	want := "jail,arrest_no,jacket,agency,booked,released,fetch_status,cases,charges,holds,charge_descriptions,booked_at,released_at\n" +
+		`test,123,,,6/28/2024T10:22:44,,ok,0,2,0,"TRESPASS; CONTEMPT, OF COURT",2024-06-28T10:22:44-05:00,` + "\n"
+	if out.String() != want {
+		t.Fatalf("unexpected CSV.\nGot  %q\nWant %q", out.String(), want)
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	day, err := parseDay("2024-07-16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !day.Equal(time.Date(2024, 7, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected day: %v", day)
+	}
+	if _, err := parseDay("07/16/2024"); err == nil {
+		t.Fatal("expected error for a date in the wrong format")
+	}
+}
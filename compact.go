@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+)
+
+// runCompact implements `jtt compact`, which rewrites cached snapshots in the configured compression format.
+// Snapshots are checked before they're converted; corrupt ones are left alone.
+func runCompact(args []string) error {
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	addCacheFlag(flags)
+	compression := flags.String("compression", "", "format to convert to (default from config)")
+	dryRun := flags.Bool("dry-run", false, "list the snapshots that would be converted, without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *compression == "" {
+		*compression = appConfig.Compression
+		if *compression == "" || *compression == CompressionNone {
+			return errors.New("no compression configured; set Compression in the config or pass -compression")
+		}
+	}
+	format, err := parseCompression(*compression)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(appConfig.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to list cache directory: %w", err)
+	}
+	var converted, skipped int
+	var before, after int64
+	for _, entry := range entries {
+		jailName, day, ext, ok := parseSnapshotName(entry.Name())
+		if entry.IsDir() || !ok || ext == compressionExts[format] {
+			continue
+		}
+		filename := path.Join(appConfig.Cache, entry.Name())
+		if *dryRun {
+			fmt.Println(filename)
+			converted++
+			continue
+		}
+		sizeBefore, sizeAfter, err := compactSnapshot(filename, format)
+		if errors.Is(err, errCorruptSnapshot) {
+			log.Printf("Skipping %v", err)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to compact %s for %s: %w", jailName, day, err)
+		}
+		converted++
+		before += sizeBefore
+		after += sizeAfter
+	}
+
+	if *dryRun {
+		log.Printf("Would convert %d snapshots to %s", converted, format)
+		return nil
+	}
+	log.Printf("Converted %d snapshots to %s: %s before, %s after. Skipped %d corrupt snapshots.",
+		converted, format, formatBytes(before), formatBytes(after), skipped)
+	return nil
+}
+
+// compactSnapshot rewrites a snapshot in the given format, removing the original, and returns both sizes.
+// The snapshot's JSON is kept byte for byte, rather than round-tripped through Jail.
+func compactSnapshot(filename string, format string) (int64, int64, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	data, err := decompress(raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	if _, err := decodeSnapshot(filename, data); err != nil {
+		return 0, 0, err
+	}
+	// Also removes the original, since it's the same snapshot in another format
+	jailName, day, _, _ := parseSnapshotName(filename)
+	newName := path.Join(path.Dir(filename), jailName+"-"+day+compressionExts[format])
+	if err := writeSnapshot(newName, data, format); err != nil {
+		return 0, 0, err
+	}
+	info, err := os.Stat(newName)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(len(raw)), info.Size(), nil
+}
+
+// formatBytes formats a size for people, like "1.5 MB".
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats for snapshots, set by AppConfig.Compression.
+// Snapshots are read in whichever format they were written, so this can be changed at any time.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// File extension for each format
+var compressionExts = map[string]string{
+	CompressionNone: ".json",
+	CompressionGzip: ".json.gz",
+	CompressionZstd: ".json.zst",
+}
+
+// Leading bytes of each compressed format
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// parseCompression checks a compression format from the config or command line. Empty means CompressionNone.
+func parseCompression(s string) (string, error) {
+	if s == "" {
+		return CompressionNone, nil
+	}
+	if _, ok := compressionExts[s]; !ok {
+		return "", fmt.Errorf(`unknown compression "%s"; expected %s, %s or %s`, s, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+	return s, nil
+}
+
+// SnapshotCompression returns the configured compression format.
+// An unknown format is an error rather than quietly writing uncompressed snapshots.
+func (config *AppConfig) SnapshotCompression() (string, error) {
+	return parseCompression(config.Compression)
+}
+
+// compress encodes data in the given format.
+func compress(data []byte, format string) ([]byte, error) {
+	switch format {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil), nil
+	default:
+		return data, nil
+	}
+}
+
+// decompress decodes data in whichever format it's in, judging by its leading bytes.
+// Uncompressed data is returned as is.
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip: %w", err)
+		}
+		defer reader.Close()
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip: %w", err)
+		}
+		return decoded, nil
+	case bytes.HasPrefix(data, zstdMagic):
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		defer decoder.Close()
+		decoded, err := decoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd: %w", err)
+		}
+		return decoded, nil
+	default:
+		return data, nil
+	}
+}
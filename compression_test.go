@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"arrestNo": "123", "charges": []},`), 100)
+	for _, format := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(format, func(t *testing.T) {
+			compressed, err := compress(data, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != CompressionNone && len(compressed) >= len(data) {
+				t.Fatalf("expected compression. Got %d bytes from %d", len(compressed), len(data))
+			}
+			decompressed, err := decompress(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Fatal("round trip changed the data")
+			}
+		})
+	}
+}
+
+func TestDecompressTruncated(t *testing.T) {
+	for _, format := range []string{CompressionGzip, CompressionZstd} {
+		compressed, err := compress(bytes.Repeat([]byte("jail "), 1000), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decompress(compressed[:len(compressed)/2]); err == nil {
+			t.Errorf("expected error for truncated %s data", format)
+		}
+	}
+}
+
+func TestSnapshotFormats(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+
+	start := time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC)
+	// An old uncompressed snapshot from the day before still reads
+	store.Compression = ""
+	if err := store.Save(&Jail{Name: "a", StartTimeUTC: start.Add(-24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	store.Compression = CompressionZstd
+	if err := store.Save(&Jail{Name: "a", StartTimeUTC: start}); err != nil {
+		t.Fatal(err)
+	}
+	jail, filename, err := store.Latest("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Base(filename) != "a-2024-07-16.json.zst" || !jail.StartTimeUTC.Equal(start) {
+		t.Fatalf("unexpected latest snapshot %s from %v", filename, jail.StartTimeUTC)
+	}
+	if _, filename, err := store.ForDay("a", start.Add(-24*time.Hour)); err != nil || path.Base(filename) != "a-2024-07-15.json" {
+		t.Fatalf("unexpected snapshot for the day before: %s, %v", filename, err)
+	}
+
+	// Saving the same day in another format replaces the old file
+	store.Compression = CompressionGzip
+	if err := store.Save(&Jail{Name: "a", StartTimeUTC: start}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(store.Dir, "a-2024-07-16.json.zst")); !os.IsNotExist(err) {
+		t.Fatalf("expected zstd copy to be removed. Got %v", err)
+	}
+	if _, filename, err := store.Latest("a"); err != nil || path.Base(filename) != "a-2024-07-16.json.gz" {
+		t.Fatalf("unexpected latest snapshot: %s, %v", filename, err)
+	}
+}
+
+func TestCompactSnapshot(t *testing.T) {
+	oldCache := appConfig.Cache
+	appConfig.Cache = t.TempDir()
+	defer func() { appConfig.Cache = oldCache }()
+
+	original := path.Join(appConfig.Cache, "a-2024-07-16.json")
+	// Includes a field Jail doesn't have, which compacting should keep
+	data := []byte(`{"Name": "a", "StartTimeUTC": "2024-07-16T03:00:00Z", "Retired": true}`)
+	if err := os.WriteFile(original, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, after, err := compactSnapshot(original, CompressionGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != int64(len(data)) || after == 0 {
+		t.Fatalf("unexpected sizes: %d before, %d after", before, after)
+	}
+	if _, err := os.Stat(original); !os.IsNotExist(err) {
+		t.Fatalf("expected original to be removed. Got %v", err)
+	}
+	raw, err := os.ReadFile(original + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := decompress(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Fatalf("expected the JSON to be kept byte for byte. Got %s", decompressed)
+	}
+
+	corrupt := path.Join(appConfig.Cache, "b-2024-07-16.json")
+	if err := os.WriteFile(corrupt, []byte(`{"Name": "b", "Sta`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := compactSnapshot(corrupt, CompressionGzip); err == nil {
+		t.Fatal("expected error compacting a corrupt snapshot")
+	}
+	if _, err := os.Stat(corrupt); err != nil {
+		t.Fatalf("expected corrupt snapshot to be left alone. Got %v", err)
+	}
+}
+
+func TestOpenStoreRejectsUnknownCompression(t *testing.T) {
+	config := &AppConfig{Cache: t.TempDir(), Compression: "gz"}
+	if _, err := config.OpenStore(); err == nil {
+		t.Fatal("expected error rather than uncompressed snapshots")
+	}
+	config.Compression = CompressionGzip
+	store, err := config.OpenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if store.(*JSONStore).Compression != CompressionGzip {
+		t.Fatalf("unexpected store %+v", store)
+	}
+}
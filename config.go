@@ -5,11 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 )
 
 const DefaultJailBaseURL = "https://omsweb.public-safety-cloud.com"
 
+// Number of jails crawled at once, unless AppConfig.Workers says otherwise
+const DefaultWorkers = 4
+
+// Number of inmates between saves of a crawl in progress, unless AppConfig.CheckpointEvery says otherwise
+const DefaultCheckpointEvery = 25
+
+// Longest a single jail's crawl may take, unless configured otherwise.
+// Once it's up, whatever has been fetched so far is saved.
+const DefaultJailTimeout = 3 * time.Hour
+
 type JailConfig struct {
 	// Used in API URLs; the jail's unique identifier in JailTracker
 	Slug string
@@ -25,6 +38,9 @@ type JailConfig struct {
 	// Name and state of facility
 	Facility string
 	State    string
+	// IANA time zone of the facility, like "America/Chicago", for parsing its timestamps.
+	// Defaults to the zone of State; set this for facilities in the part of a state with another zone.
+	TimeZone string
 	// URL for the jail. Usually "https://omsweb.public-safety-cloud.com", but not always!
 	BaseURL string
 	// The main public website of the facility itself
@@ -36,12 +52,88 @@ type JailConfig struct {
 	HasAdvancedSearch bool
 	// Notes on the entry; e.g. why it isn't usable
 	Notes string
+	// Name of the captcha solver to use for this jail. Overrides AppConfig.Solver.
+	Solver string
+	// Politeness policy for this jail. Overrides AppConfig.RateLimit.
+	// Jails on the same host share one limiter, which uses the strictest policy among them.
+	RateLimit *RateLimit
+	// Deadline for crawling this jail, in minutes. Overrides AppConfig.JailTimeoutMinutes.
+	TimeoutMinutes int
+	// Free-form labels for picking jails on the command line, like "flaky" or "gulf-coast"
+	Tags []string
 }
 
 type AppConfig struct {
 	Jails []JailConfig
 	// Directory to cache jail data
 	Cache string
+	// When to use a cached snapshot rather than crawling; see CacheMode. Defaults to CacheFresh.
+	CacheMode string
+	// Format for new snapshots: CompressionNone (the default), CompressionGzip or CompressionZstd.
+	// Snapshots in any format can be read; `jtt compact` converts old ones.
+	Compression string
+	// How old a snapshot may be and still be fresh, in hours.
+	// Defaults to 0, meaning only a snapshot started on the current UTC day.
+	CacheMaxAgeHours int
+	// Where snapshots are kept: StorageJSON (the default), one file per jail per day under Cache,
+	// or StorageSQLite, a database of every crawl.
+	Storage string
+	// SQLite database for StorageSQLite. Defaults to jtt.db under Cache.
+	SQLitePath string
+	// Name of the captcha solver to use, unless a jail sets its own. Defaults to DefaultSolver.
+	Solver string
+	// Named solver definitions, referenced by Solver above and in JailConfig.
+	Solvers map[string]SolverConfig
+	// Whether to save every captcha, with its solution and verdict, under <Cache>/captcha-corpus
+	CaptchaCorpus bool
+	// Number of jails to crawl at once. Defaults to DefaultWorkers.
+	// Jails on the same host share a RateLimiter however many workers there are.
+	Workers int
+	// Politeness policy for requests to each JailTracker host. Defaults to DefaultRateLimit.
+	RateLimit *RateLimit
+	// Deadline for each request, in seconds. Defaults to DefaultRequestTimeout.
+	RequestTimeoutSeconds int
+	// Deadline for crawling each jail, in minutes. Defaults to DefaultJailTimeout.
+	JailTimeoutMinutes int
+	// Number of inmates between saves of a crawl in progress. Defaults to DefaultCheckpointEvery.
+	CheckpointEvery int
+	// Named jail filters, picked on the command line with -group
+	Groups map[string]JailFilter
+}
+
+// WorkerCount returns the configured number of crawl workers, or the default.
+func (config *AppConfig) WorkerCount() int {
+	if config.Workers > 0 {
+		return config.Workers
+	}
+	return DefaultWorkers
+}
+
+// CheckpointInterval returns the configured number of inmates between saves, or the default.
+func (config *AppConfig) CheckpointInterval() int {
+	if config.CheckpointEvery > 0 {
+		return config.CheckpointEvery
+	}
+	return DefaultCheckpointEvery
+}
+
+// RequestTimeout returns the configured deadline for each request, or the default.
+func (config *AppConfig) RequestTimeout() time.Duration {
+	if config.RequestTimeoutSeconds > 0 {
+		return time.Duration(config.RequestTimeoutSeconds) * time.Second
+	}
+	return DefaultRequestTimeout
+}
+
+// JailTimeout returns the deadline for crawling a jail: its own if set, then the app-wide one, then the default.
+func (config *AppConfig) JailTimeout(jailConfig *JailConfig) time.Duration {
+	if jailConfig.TimeoutMinutes > 0 {
+		return time.Duration(jailConfig.TimeoutMinutes) * time.Minute
+	}
+	if config.JailTimeoutMinutes > 0 {
+		return time.Duration(config.JailTimeoutMinutes) * time.Minute
+	}
+	return DefaultJailTimeout
 }
 
 // Marshal data from filename into provided config
@@ -64,8 +156,91 @@ func (config *AppConfig) LoadConfig(filename string) error {
 	return nil
 }
 
+// Validate returns every problem found in the config, rather than stopping at the first.
+// Solvers are built to check them, but nothing is requested.
+func (config *AppConfig) Validate() []error {
+	var problems []error
+	if config.Cache == "" {
+		problems = append(problems, errors.New("Cache is not set"))
+	}
+	if config.Workers < 0 {
+		problems = append(problems, errors.New("Workers must not be negative"))
+	}
+	if config.RequestTimeoutSeconds < 0 || config.JailTimeoutMinutes < 0 {
+		problems = append(problems, errors.New("timeouts must not be negative"))
+	}
+	if _, err := parseCacheMode(config.CacheMode); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := parseCompression(config.Compression); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := parseStorage(config.Storage); err != nil {
+		problems = append(problems, err)
+	}
+	if config.CacheMaxAgeHours < 0 {
+		problems = append(problems, errors.New("CacheMaxAgeHours must not be negative"))
+	}
+	if config.CheckpointEvery < 0 {
+		problems = append(problems, errors.New("CheckpointEvery must not be negative"))
+	}
+	if err := config.RateLimit.validate(); err != nil {
+		problems = append(problems, err)
+	}
+
+	solverNames := map[string]bool{config.SolverName(nil): true}
+	slugs := map[string]bool{}
+	for i := range config.Jails {
+		jailConfig := &config.Jails[i]
+		if jailConfig.Slug == "" {
+			problems = append(problems, fmt.Errorf("jail %d has no Slug", i))
+			continue
+		}
+		if slugs[jailConfig.Slug] {
+			problems = append(problems, fmt.Errorf(`jail "%s" is listed more than once`, jailConfig.Slug))
+		}
+		slugs[jailConfig.Slug] = true
+		if u, err := url.Parse(jailConfig.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf(`jail "%s" has an invalid BaseURL "%s"`, jailConfig.Slug, jailConfig.BaseURL))
+		}
+		if _, err := jailConfig.Location(); err != nil {
+			problems = append(problems, err)
+		}
+		if jailConfig.TimeoutMinutes < 0 {
+			problems = append(problems, fmt.Errorf(`jail "%s" has a negative TimeoutMinutes`, jailConfig.Slug))
+		}
+		if err := jailConfig.RateLimit.validate(); err != nil {
+			problems = append(problems, fmt.Errorf(`jail "%s": %w`, jailConfig.Slug, err))
+		}
+		solverNames[config.SolverName(jailConfig)] = true
+	}
+	for name, group := range config.Groups {
+		if len(group.Groups) > 0 {
+			problems = append(problems, fmt.Errorf(`group "%s" can't include other groups`, name))
+		}
+		if err := group.validate(); err != nil {
+			problems = append(problems, fmt.Errorf(`group "%s": %w`, name, err))
+		}
+	}
+	for name := range solverNames {
+		if _, err := config.NewSolver(name); err != nil {
+			problems = append(problems, fmt.Errorf(`solver "%s": %w`, name, err))
+		}
+	}
+	return problems
+}
+
 type AppEnv struct {
 	OpenAIAPIKey string // "JTT_OPENAI_API_KEY"
+	// Defaults for OpenAI solvers; see SolverConfig
+	OpenAIBaseURL string // "JTT_OPENAI_BASE_URL"
+	OpenAIModel   string // "JTT_OPENAI_MODEL"
+	OpenAIPrompt  string // "JTT_OPENAI_PROMPT"
+	// Kept as text, and checked when a solver is built
+	OpenAITemperature string // "JTT_OPENAI_TEMPERATURE"
+	OpenAIMaxTokens   string // "JTT_OPENAI_MAX_TOKENS"
+	// Shared research database for `jtt sync`, as a URL or key=value string
+	PostgresDSN string // "JTT_POSTGRES_DSN"
 	// Directory to cache jail data
 	ConfigPath string // "JTT_CONFIG_PATH"
 }
@@ -73,6 +248,12 @@ type AppEnv struct {
 // Load sets default values for empty optional environment variables
 func (a *AppEnv) Load() {
 	a.OpenAIAPIKey = os.Getenv("JTT_OPENAI_API_KEY")
+	a.OpenAIBaseURL = os.Getenv("JTT_OPENAI_BASE_URL")
+	a.OpenAIModel = os.Getenv("JTT_OPENAI_MODEL")
+	a.OpenAIPrompt = os.Getenv("JTT_OPENAI_PROMPT")
+	a.OpenAITemperature = os.Getenv("JTT_OPENAI_TEMPERATURE")
+	a.OpenAIMaxTokens = os.Getenv("JTT_OPENAI_MAX_TOKENS")
+	a.PostgresDSN = os.Getenv("JTT_POSTGRES_DSN")
 
 	a.ConfigPath = os.Getenv("JTT_CONFIG_PATH")
 	if a.ConfigPath == "" {
@@ -82,10 +263,37 @@ func (a *AppEnv) Load() {
 	}
 }
 
+// applyOpenAIDefaults sets an OpenAI solver's model, prompt, temperature and token limit from the environment,
+// where they're set. Settings in config.json are applied after, and win.
+func (a *AppEnv) applyOpenAIDefaults(solver *OpenAISolver) error {
+	if a.OpenAIModel != "" {
+		solver.Model = a.OpenAIModel
+	}
+	if a.OpenAIPrompt != "" {
+		solver.Prompt = a.OpenAIPrompt
+	}
+	if a.OpenAITemperature != "" {
+		temperature, err := strconv.ParseFloat(a.OpenAITemperature, 64)
+		if err != nil {
+			return fmt.Errorf("invalid JTT_OPENAI_TEMPERATURE: %w", err)
+		}
+		solver.Temperature = &temperature
+	}
+	if a.OpenAIMaxTokens != "" {
+		maxTokens, err := strconv.Atoi(a.OpenAIMaxTokens)
+		if err != nil || maxTokens <= 0 {
+			return fmt.Errorf("invalid JTT_OPENAI_MAX_TOKENS \"%s\"; expected a positive whole number", a.OpenAIMaxTokens)
+		}
+		solver.MaxTokens = maxTokens
+	}
+	return nil
+}
+
 // Validate checks that required environment variables are set.
 // This is a separate step from Load, since it shouldn't be run on init() during tests.
-func (a *AppEnv) ValidateRequired() error {
-	if a.OpenAIAPIKey == "" {
+// The OpenAI key is only required if the config will actually call the OpenAI API.
+func (a *AppEnv) ValidateRequired(config *AppConfig) error {
+	if a.OpenAIAPIKey == "" && config.NeedsOpenAIKey() {
 		return errors.New("JTT_OPENAI_API_KEY must be set")
 	}
 	return nil
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAppConfigValidate(t *testing.T) {
+	config := &AppConfig{
+		Cache:     "",
+		Workers:   -1,
+		CacheMode: "sometimes",
+		Storage:   "postgres",
+		RateLimit: &RateLimit{RequestsPerSecond: -1},
+		Groups: map[string]JailFilter{
+			"nested": {Groups: []string{"other"}},
+			"typo":   {Slugs: []string{"[ok"}},
+		},
+		Jails: []JailConfig{
+			{Slug: "ok", BaseURL: DefaultJailBaseURL, State: "MS"},
+			{Slug: "ok", BaseURL: DefaultJailBaseURL, State: "MS"},
+			{Slug: "bad-url", BaseURL: "omsweb.public-safety-cloud.com", State: "MS"},
+			{Slug: "bad-solver", BaseURL: DefaultJailBaseURL, Solver: "psychic", State: "MS"},
+			{Slug: "bad-zone", BaseURL: DefaultJailBaseURL, TimeZone: "America/Biloxi"},
+			{Slug: "no-zone", BaseURL: DefaultJailBaseURL, State: "XX"},
+			{BaseURL: DefaultJailBaseURL},
+		},
+	}
+	problems := config.Validate()
+	var messages []string
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"Cache is not set",
+		"Workers must not be negative",
+		`unknown cache mode "sometimes"`,
+		`unknown storage "postgres"`,
+		"RateLimit must not be negative",
+		`jail "ok" is listed more than once`,
+		`jail "bad-url" has an invalid BaseURL`,
+		`solver "psychic"`,
+		`jail "bad-zone" has an invalid TimeZone`,
+		`no time zone is known for State "XX"`,
+		"jail 6 has no Slug",
+		`group "nested" can't include other groups`,
+		`group "typo": bad jail pattern "[ok"`,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected a problem containing %q. Got:\n%s", want, all)
+		}
+	}
+	if len(problems) != 13 {
+		t.Errorf("unexpected number of problems. Got %d, want 13:\n%s", len(problems), all)
+	}
+
+	valid := &AppConfig{Cache: os.TempDir(), Jails: []JailConfig{{Slug: "ok", BaseURL: DefaultJailBaseURL, State: "MS"}}}
+	if problems := valid.Validate(); len(problems) != 0 {
+		t.Fatalf("unexpected problems with valid config: %v", problems)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Subdirectory of the cache directory where the captcha corpus is kept
+const corpusDirName = "captcha-corpus"
+
+// The corpus to record captcha attempts to. Nil unless AppConfig.CaptchaCorpus is set.
+var captchaCorpus *CaptchaCorpus
+
+// CorpusEntry records a single solve attempt.
+type CorpusEntry struct {
+	// SHA-256 of the image file, which is stored as <Image>.gif
+	Image string
+	// Jail the captcha was fetched for
+	Jail string
+	// Solver that produced Solution. See CaptchaGuess.Solver.
+	Solver     string
+	Solution   string
+	Confidence float64
+	// Whether Solution matched solutionPattern. If not, it wasn't submitted.
+	FormatValid bool
+	// JailTracker's verdict. Only meaningful if FormatValid.
+	Matched bool
+	TimeUTC time.Time
+}
+
+// Labelled reports whether JailTracker confirmed Solution as the text in the image.
+func (e *CorpusEntry) Labelled() bool {
+	return e.FormatValid && e.Matched
+}
+
+// CaptchaCorpus stores captcha images alongside the answers given for them,
+// to be used as training and benchmark data for solvers.
+// Images are stored once each, named by content hash. Attempts are appended to index.jsonl.
+type CaptchaCorpus struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewCaptchaCorpus(dir string) *CaptchaCorpus {
+	return &CaptchaCorpus{Dir: dir}
+}
+
+func (c *CaptchaCorpus) indexPath() string {
+	return path.Join(c.Dir, "index.jsonl")
+}
+
+func (c *CaptchaCorpus) imagePath(image string) string {
+	return path.Join(c.Dir, image+".gif")
+}
+
+// Record saves the image, if it isn't already stored, and appends the attempt to the index.
+// entry.Image is set from the image contents.
+func (c *CaptchaCorpus) Record(inlineImage string, entry CorpusEntry) error {
+	data, err := decodeInlineImageBytes(inlineImage)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	entry.Image = hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = os.MkdirAll(c.Dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create corpus directory: %w", err)
+	}
+	imagePath := c.imagePath(entry.Image)
+	if _, err := os.Stat(imagePath); errors.Is(err, os.ErrNotExist) {
+		err = os.WriteFile(imagePath, data, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write corpus image: %w", err)
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal corpus entry: %w", err)
+	}
+	file, err := os.OpenFile(c.indexPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open corpus index: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write corpus index: %w", err)
+	}
+	return nil
+}
+
+// Entries reads every attempt in the index, oldest first.
+func (c *CaptchaCorpus) Entries() ([]CorpusEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readEntries()
+}
+
+func (c *CaptchaCorpus) readEntries() ([]CorpusEntry, error) {
+	file, err := os.Open(c.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open corpus index: %w", err)
+	}
+	defer file.Close()
+
+	var entries []CorpusEntry
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		entry := CorpusEntry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal corpus index line %d: %w", n, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read corpus index: %w", err)
+	}
+	return entries, nil
+}
+
+// CorpusImage summarizes every attempt on one image.
+type CorpusImage struct {
+	Image string
+	// The confirmed solution, or "" if no attempt matched
+	Label    string
+	Attempts int
+	Jails    []string
+}
+
+// Images groups the index by image, sorted by hash.
+func (c *CaptchaCorpus) Images() ([]CorpusImage, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return groupCorpusEntries(entries), nil
+}
+
+func groupCorpusEntries(entries []CorpusEntry) []CorpusImage {
+	byImage := map[string]*CorpusImage{}
+	for _, entry := range entries {
+		image, ok := byImage[entry.Image]
+		if !ok {
+			image = &CorpusImage{Image: entry.Image}
+			byImage[entry.Image] = image
+		}
+		image.Attempts++
+		if entry.Labelled() {
+			image.Label = entry.Solution
+		}
+		if !containsString(image.Jails, entry.Jail) {
+			image.Jails = append(image.Jails, entry.Jail)
+		}
+	}
+	images := make([]CorpusImage, 0, len(byImage))
+	for _, image := range byImage {
+		images = append(images, *image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Image < images[j].Image })
+	return images
+}
+
+// Dedupe rewrites the index without repeated attempts: the same answer from the same solver
+// with the same verdict is kept only once. Images with no remaining attempts are deleted.
+// Returns the number of index entries removed.
+func (c *CaptchaCorpus) Dedupe() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.readEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	type attemptKey struct {
+		Image, Solver, Solution string
+		FormatValid, Matched    bool
+	}
+	seen := map[attemptKey]bool{}
+	images := map[string]bool{}
+	var kept []CorpusEntry
+	for _, entry := range entries {
+		key := attemptKey{entry.Image, entry.Solver, entry.Solution, entry.FormatValid, entry.Matched}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		images[entry.Image] = true
+		kept = append(kept, entry)
+	}
+
+	// Rewrite atomically, so a failure doesn't lose the index
+	var index bytes.Buffer
+	for _, entry := range kept {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal corpus entry: %w", err)
+		}
+		index.Write(append(line, '\n'))
+	}
+	if err := writeFileAtomic(c.indexPath(), index.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to replace corpus index: %w", err)
+	}
+
+	// Remove orphaned images
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list corpus directory: %w", err)
+	}
+	for _, f := range files {
+		name := f.Name()
+		if path.Ext(name) != ".gif" || images[name[:len(name)-len(".gif")]] {
+			continue
+		}
+		if err := os.Remove(path.Join(c.Dir, name)); err != nil {
+			return 0, fmt.Errorf("failed to remove orphaned image: %w", err)
+		}
+	}
+	return len(entries) - len(kept), nil
+}
+
+// Export copies every labelled image into dir as <label>_<hash prefix>.gif,
+// so the label can be read back from the file name. Returns the number of images exported.
+func (c *CaptchaCorpus) Export(dir string) (int, error) {
+	images, err := c.Images()
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	exported := 0
+	for _, image := range images {
+		if image.Label == "" {
+			continue
+		}
+		data, err := os.ReadFile(c.imagePath(image.Image))
+		if err != nil {
+			return exported, fmt.Errorf("failed to read corpus image: %w", err)
+		}
+		name := fmt.Sprintf("%s_%s.gif", image.Label, image.Image[:12])
+		err = os.WriteFile(path.Join(dir, name), data, 0644)
+		if err != nil {
+			return exported, fmt.Errorf("failed to export corpus image: %w", err)
+		}
+		exported++
+	}
+	return exported, nil
+}
+
+// recordCaptcha adds an attempt to the corpus, if one is configured.
+// Failures are only logged; the corpus shouldn't interrupt a crawl.
+func recordCaptcha(inlineImage string, entry CorpusEntry) {
+	if captchaCorpus == nil {
+		return
+	}
+	entry.TimeUTC = time.Now().UTC()
+	err := captchaCorpus.Record(inlineImage, entry)
+	if err != nil {
+		log.Printf("failed to record captcha to corpus: %v", err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runCaptchaCorpus implements `jtt captcha-corpus list|dedupe|export`.
+func runCaptchaCorpus(args []string) error {
+	flags := flag.NewFlagSet("captcha-corpus", flag.ContinueOnError)
+	dir := flags.String("dir", path.Join(appConfig.Cache, corpusDirName), "corpus directory")
+	out := flags.String("out", "captcha-export", "export: directory to write labelled images to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jtt captcha-corpus [flags] list|dedupe|export")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one action")
+	}
+
+	corpus := NewCaptchaCorpus(*dir)
+	switch flags.Arg(0) {
+	case "list":
+		images, err := corpus.Images()
+		if err != nil {
+			return err
+		}
+		return printCorpusImages(os.Stdout, images)
+	case "dedupe":
+		removed, err := corpus.Dedupe()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d duplicate attempts\n", removed)
+	case "export":
+		exported, err := corpus.Export(*out)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d labelled images to %s\n", exported, *out)
+	default:
+		flags.Usage()
+		return fmt.Errorf(`unknown action "%s"`, flags.Arg(0))
+	}
+	return nil
+}
+
+func printCorpusImages(w io.Writer, images []CorpusImage) error {
+	labelled := 0
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tLABEL\tATTEMPTS\tJAILS")
+	for _, image := range images {
+		label := image.Label
+		if label == "" {
+			label = "-"
+		} else {
+			labelled++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%v\n", image.Image[:12], label, image.Attempts, image.Jails)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d images, %d labelled\n", len(images), labelled)
+	return err
+}
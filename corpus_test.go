@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCaptchaCorpus(t *testing.T) {
+	corpus := NewCaptchaCorpus(path.Join(t.TempDir(), corpusDirName))
+	// Contents don't need to be a real GIF; the corpus only hashes and stores them
+	imageA := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("image A"))
+	imageB := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("image B"))
+
+	attempts := []struct {
+		Image string
+		Entry CorpusEntry
+	}{
+		{imageA, CorpusEntry{Jail: "one", Solver: "local", Solution: "abcd", FormatValid: true, Matched: false}},
+		{imageA, CorpusEntry{Jail: "one", Solver: "local", Solution: "abcd", FormatValid: true, Matched: false}},
+		{imageA, CorpusEntry{Jail: "one", Solver: "openai", Solution: "abCd", FormatValid: true, Matched: true}},
+		{imageB, CorpusEntry{Jail: "two", Solver: "openai", Solution: "ab cd", FormatValid: false}},
+	}
+	for _, a := range attempts {
+		if err := corpus.Record(a.Image, a.Entry); err != nil {
+			t.Fatalf("unexpected error recording attempt: %v", err)
+		}
+	}
+	if err := corpus.Record("TEST_IMAGE", CorpusEntry{}); err == nil {
+		t.Fatal("expected error recording an image that isn't a data URL, got nil")
+	}
+
+	images, err := corpus.Images()
+	if err != nil {
+		t.Fatalf("unexpected error listing images: %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("unexpected image count. Got %d, want 2", len(images))
+	}
+	for _, image := range images {
+		// Only a matched solution counts as a label
+		if image.Attempts == 3 && image.Label != "abCd" {
+			t.Fatalf(`expected image A to be labelled "abCd", got "%s"`, image.Label)
+		}
+		if image.Attempts == 1 && image.Label != "" {
+			t.Fatalf(`expected image B to be unlabelled, got "%s"`, image.Label)
+		}
+	}
+
+	removed, err := corpus.Dedupe()
+	if err != nil {
+		t.Fatalf("unexpected error deduping: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("unexpected dedupe count. Got %d, want 1", removed)
+	}
+	entries, err := corpus.Entries()
+	if err != nil {
+		t.Fatalf("unexpected error reading entries: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entry count after dedupe. Got %d, want 3", len(entries))
+	}
+
+	out := t.TempDir()
+	exported, err := corpus.Export(out)
+	if err != nil {
+		t.Fatalf("unexpected error exporting: %v", err)
+	}
+	if exported != 1 {
+		t.Fatalf("unexpected export count. Got %d, want 1", exported)
+	}
+	files, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatalf("failed to read export directory: %v", err)
+	}
+	if len(files) != 1 || files[0].Name()[:5] != "abCd_" {
+		t.Fatalf("unexpected export contents: %v", files)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// runCrawl implements `jtt crawl`, which is also what `jtt` does with no subcommand.
+func runCrawl(args []string) error {
+	flags := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	filter := &JailFilter{}
+	filter.addFlags(flags)
+	addCacheFlag(flags)
+	addStorageFlag(flags)
+	policy, err := appConfig.CachePolicy()
+	if err != nil {
+		return err
+	}
+	flags.Func("cache-mode", fmt.Sprintf("when to use cached snapshots: one of %v (default from config, or fresh)", cacheModes), func(s string) error {
+		mode, err := parseCacheMode(s)
+		policy.Mode = mode
+		return err
+	})
+	flags.DurationVar(&policy.MaxAge, "max-age", policy.MaxAge, "how old a snapshot may be and still be fresh, like 12h (0 means started today, UTC)")
+	force := flags.Bool("force", false, "crawl again even if a fresh snapshot is cached; short for -cache-mode refresh")
+	dryRun := flags.Bool("dry-run", false, "show what would be crawled, without making any requests")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jtt crawl [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *force {
+		policy.Mode = CacheRefresh
+	}
+	jailConfigs, err := filter.Select(appConfig)
+	if err != nil {
+		return err
+	}
+	store, err := appConfig.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if *dryRun {
+		return printCrawlPlan(os.Stdout, store, jailConfigs, policy)
+	}
+
+	// Cache-only runs make no requests, so need no solvers or key
+	if policy.Mode != CacheOnly {
+		var usable []*JailConfig
+		for _, jailConfig := range jailConfigs {
+			if jailConfig.Usable {
+				usable = append(usable, jailConfig)
+			}
+		}
+		err = requireOpenAIKey(usable)
+		if err != nil {
+			return err
+		}
+	}
+	if appConfig.CaptchaCorpus {
+		captchaCorpus = NewCaptchaCorpus(path.Join(appConfig.Cache, corpusDirName))
+	}
+	registerRateLimits(appConfig)
+	httpClient.Timeout = appConfig.RequestTimeout()
+
+	// On Ctrl-C or SIGTERM, crawls stop and save what they have. A second signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Closed before stop() on return, so a finished run isn't reported as stopping
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+		stop()
+		log.Printf("Stopping: saving partial jail data. Interrupt again to quit immediately.")
+	}()
+
+	report := &RunReport{StartTimeUTC: time.Now().UTC()}
+	reports := map[*JailConfig]JailReport{}
+	var reportsMu sync.Mutex
+	forEachJail(ctx, jailConfigs, appConfig.WorkerCount(), func(jailConfig *JailConfig) {
+		jailReport := crawlForReport(ctx, store, jailConfig, policy)
+		reportsMu.Lock()
+		reports[jailConfig] = jailReport
+		reportsMu.Unlock()
+	})
+	report.EndTimeUTC = time.Now().UTC()
+	report.Interrupted = ctx.Err() != nil
+	for _, jailConfig := range jailConfigs {
+		jailReport, ok := reports[jailConfig]
+		if !ok {
+			jailReport = newJailReport(jailConfig, OutcomeNotRun, nil, 0, nil)
+		}
+		report.Jails = append(report.Jails, jailReport)
+	}
+
+	for _, line := range rateLimitSummary() {
+		log.Printf("Requests to %s", line)
+	}
+	if filename, err := report.Save(appConfig.Cache); err != nil {
+		log.Printf("Failed to save run report: %v", err)
+	} else {
+		log.Printf("Run report saved as \"%s\"", filename)
+	}
+	// To stdout rather than the log, so it stands out in a cron job's output
+	return report.Print(os.Stdout)
+}
+
+// crawlForReport loads or crawls a jail, within its deadline, and summarizes what happened.
+func crawlForReport(ctx context.Context, store SnapshotStore, jailConfig *JailConfig, policy CachePolicy) JailReport {
+	logger := jailLogger(jailConfig.Slug)
+	if !jailConfig.Usable {
+		logger.Printf("Skipped. Not usable.")
+		return newJailReport(jailConfig, OutcomeSkipped, nil, 0, nil)
+	}
+	start := time.Now()
+	jailCtx, cancel := context.WithTimeout(ctx, appConfig.JailTimeout(jailConfig))
+	defer cancel()
+	// Pushing to the shared database is a separate step; see `jtt sync`.
+	jail, err := LoadJailCached(jailCtx, store, jailConfig, policy)
+	if err != nil {
+		logger.Printf("Failed to load: %s", err)
+		return newJailReport(jailConfig, OutcomeFailed, jail, time.Since(start), err)
+	}
+	outcome := OutcomeCrawled
+	if jail.cached {
+		outcome = OutcomeCached
+	}
+	return newJailReport(jailConfig, outcome, jail, time.Since(start), nil)
+}
+
+// forEachJail calls f for each jail config from a pool of workers, returning when all calls have returned.
+// Once ctx is done, no more jails are started.
+// Jails on the same host still take turns making requests; see RateLimiter.
+func forEachJail(ctx context.Context, jailConfigs []*JailConfig, workers int, f func(*JailConfig)) {
+	jobs := make(chan *JailConfig)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jailConfig := range jobs {
+				f(jailConfig)
+			}
+		}()
+	}
+feed:
+	for _, jailConfig := range jailConfigs {
+		select {
+		case jobs <- jailConfig:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// crawlPlan describes what crawling a jail would do under the cache policy, and where in the store it would be.
+func crawlPlan(store SnapshotStore, jailConfig *JailConfig, policy CachePolicy, now time.Time) (string, string) {
+	newPath := store.Where(&Jail{Name: jailConfig.Slug, StartTimeUTC: now})
+	if !jailConfig.Usable {
+		return "skip (not usable)", ""
+	}
+	var jail *Jail
+	var filename string
+	if policy.Mode != CacheRefresh {
+		var err error
+		jail, filename, err = store.Latest(jailConfig.Slug)
+		if errors.Is(err, errCorruptSnapshot) {
+			return "quarantine corrupt snapshot, then check older ones", filename
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Sprintf("fail (%v)", err), filename
+		}
+	}
+	action, reason := policy.decide(jail, now)
+	switch action {
+	case cacheMiss:
+		return fmt.Sprintf("fail (%s)", reason), ""
+	case cacheUse:
+		return fmt.Sprintf("load from cache (%s)", reason), filename
+	case cacheResume:
+		fetched, _, _ := jail.FetchCounts()
+		return fmt.Sprintf("resume (%d of %d inmates left)", len(jail.Inmates)-fetched, len(jail.Inmates)), filename
+	default:
+		return fmt.Sprintf("crawl (%s)", reason), newPath
+	}
+}
+
+// printCrawlPlan writes what crawling each jail would do, for -dry-run.
+func printCrawlPlan(w io.Writer, store SnapshotStore, jailConfigs []*JailConfig, policy CachePolicy) error {
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JAIL\tACTION\tSNAPSHOT")
+	for _, jailConfig := range jailConfigs {
+		action, filename := crawlPlan(store, jailConfig, policy, now)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", jailConfig.Slug, action, filename)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ChainSolver tries its members in order, cheapest first, stopping at the first well-formed
+// solution whose confidence reaches MinConfidence.
+// If JailTracker rejects a member's answer, the next captcha starts with the following member,
+// so a weak solver that keeps failing doesn't cost a validation round-trip every time.
+type ChainSolver struct {
+	Members       []CaptchaSolver
+	MinConfidence float64
+
+	mu sync.Mutex
+	// Index of the first member to try
+	start int
+	// Index of the member that produced the last guess
+	last int
+}
+
+// Solve returns the first acceptable guess, or failing that, the best guess from any member.
+// Token counts and cost cover every member consulted, not just the one whose guess is returned.
+func (c *ChainSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	c.mu.Lock()
+	start := c.start
+	c.mu.Unlock()
+
+	var best *CaptchaGuess
+	bestMember := start
+	spent := &CaptchaGuess{}
+	var errs []error
+	for i := start; i < len(c.Members); i++ {
+		guess, err := c.Members[i].Solve(ctx, inlineImage)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("member %d: %w", i, err))
+			continue
+		}
+		addSpend(spent, guess)
+		if best == nil || betterGuess(guess, best) {
+			best, bestMember = guess, i
+		}
+		if solutionFormatIsValid(guess.Text) && guess.Confidence >= c.MinConfidence {
+			break
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("every solver in chain failed: %w", errors.Join(errs...))
+	}
+
+	c.mu.Lock()
+	c.last = bestMember
+	c.mu.Unlock()
+	result := *best
+	result.PromptTokens = spent.PromptTokens
+	result.CompletionTokens = spent.CompletionTokens
+	result.CostUSD = spent.CostUSD
+	return &result, nil
+}
+
+// Verdict escalates to the next member after a rejection, and goes back to the cheapest after a match.
+func (c *ChainSolver) Verdict(guess *CaptchaGuess, matched bool) {
+	c.mu.Lock()
+	last := c.last
+	if matched {
+		c.start = 0
+	} else if last+1 < len(c.Members) {
+		c.start = last + 1
+	}
+	c.mu.Unlock()
+	if feedback, ok := c.Members[last].(CaptchaFeedback); ok {
+		feedback.Verdict(guess, matched)
+	}
+}
+
+// VotingSolver asks every member and takes a confidence-weighted majority vote on each character.
+type VotingSolver struct {
+	Members []CaptchaSolver
+}
+
+// Solve combines the members' guesses. Only guesses of the most common length take part in the vote.
+// Confidence is the winning share of the vote at the least agreed-upon position.
+func (v *VotingSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	result := &CaptchaGuess{Solver: "vote"}
+	var guesses []*CaptchaGuess
+	var errs []error
+	for i, member := range v.Members {
+		guess, err := member.Solve(ctx, inlineImage)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("member %d: %w", i, err))
+			continue
+		}
+		addSpend(result, guess)
+		guesses = append(guesses, guess)
+	}
+	if len(guesses) == 0 {
+		return nil, fmt.Errorf("every solver in vote failed: %w", errors.Join(errs...))
+	}
+
+	// Pick the length most guesses agree on, preferring the expected captcha length on a tie
+	lengths := map[int]int{}
+	for _, guess := range guesses {
+		lengths[len([]rune(guess.Text))]++
+	}
+	length := captchaLength
+	for l, n := range lengths {
+		if n > lengths[length] || (n == lengths[length] && length != captchaLength && l < length) {
+			length = l
+		}
+	}
+
+	text := make([]rune, length)
+	result.Confidence = 1
+	for i := range text {
+		votes := map[rune]float64{}
+		total := 0.0
+		for _, guess := range guesses {
+			runes := []rune(guess.Text)
+			if len(runes) != length {
+				continue
+			}
+			// Every vote counts for something, even from a solver with no confidence
+			weight := max(guess.Confidence, 0.01)
+			votes[runes[i]] += weight
+			total += weight
+		}
+		for r, weight := range votes {
+			if weight > votes[text[i]] || (weight == votes[text[i]] && r < text[i]) {
+				text[i] = r
+			}
+		}
+		result.Confidence = min(result.Confidence, votes[text[i]]/total)
+	}
+	result.Text = string(text)
+	return result, nil
+}
+
+// Verdict passes JailTracker's verdict on to every member.
+func (v *VotingSolver) Verdict(guess *CaptchaGuess, matched bool) {
+	for _, member := range v.Members {
+		if feedback, ok := member.(CaptchaFeedback); ok {
+			feedback.Verdict(guess, matched)
+		}
+	}
+}
+
+// betterGuess prefers well-formed solutions, then higher confidence.
+func betterGuess(a, b *CaptchaGuess) bool {
+	aValid, bValid := solutionFormatIsValid(a.Text), solutionFormatIsValid(b.Text)
+	if aValid != bValid {
+		return aValid
+	}
+	return a.Confidence > b.Confidence
+}
+
+// addSpend adds guess's token counts and cost to total.
+func addSpend(total, guess *CaptchaGuess) {
+	total.PromptTokens += guess.PromptTokens
+	total.CompletionTokens += guess.CompletionTokens
+	total.CostUSD += guess.CostUSD
+}
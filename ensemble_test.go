@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingSolver gives a fixed guess and counts how often it's asked.
+type countingSolver struct {
+	Guess CaptchaGuess
+	Err   error
+	Calls int
+}
+
+func (s *countingSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	s.Calls++
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	guess := s.Guess
+	return &guess, nil
+}
+
+func TestChainSolver(t *testing.T) {
+	cheap := &countingSolver{Guess: CaptchaGuess{Text: "a1B2", Confidence: 0.9, Solver: "local"}}
+	paid := &countingSolver{Guess: CaptchaGuess{Text: "a1B3", Confidence: 1, Solver: "openai", CostUSD: 0.001}}
+	chain := &ChainSolver{Members: []CaptchaSolver{cheap, paid}, MinConfidence: 0.8}
+
+	// Confident cheap solver is enough
+	guess, err := chain.Solve(context.Background(), "TEST_IMAGE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guess.Text != "a1B2" || paid.Calls != 0 {
+		t.Fatalf("expected cheap solver only. Got %s, paid calls %d", guess.Text, paid.Calls)
+	}
+
+	// Low confidence escalates, and spend covers both
+	cheap.Guess.Confidence = 0.5
+	guess, err = chain.Solve(context.Background(), "TEST_IMAGE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guess.Text != "a1B3" || guess.Solver != "openai" || guess.CostUSD != 0.001 {
+		t.Fatalf("expected escalation to paid solver. Got %+v", guess)
+	}
+
+	// Rejection of the cheap solver's answer skips it next time
+	cheap.Guess.Confidence = 0.9
+	guess, _ = chain.Solve(context.Background(), "TEST_IMAGE")
+	chain.Verdict(guess, false)
+	cheapCalls := cheap.Calls
+	guess, _ = chain.Solve(context.Background(), "TEST_IMAGE")
+	if guess.Solver != "openai" || cheap.Calls != cheapCalls {
+		t.Fatalf("expected escalation after rejection. Got %+v", guess)
+	}
+	// A match goes back to the cheap solver
+	chain.Verdict(guess, true)
+	guess, _ = chain.Solve(context.Background(), "TEST_IMAGE")
+	if guess.Solver != "local" {
+		t.Fatalf("expected cheap solver after match. Got %+v", guess)
+	}
+
+	// Malformed solutions escalate regardless of confidence
+	cheap.Guess.Text = "a1 B2"
+	guess, _ = chain.Solve(context.Background(), "TEST_IMAGE")
+	if guess.Solver != "openai" {
+		t.Fatalf("expected escalation for invalid format. Got %+v", guess)
+	}
+
+	// Errors fall through to the next member, and fail only if every member fails
+	cheap.Err = errors.New("broken")
+	if _, err := chain.Solve(context.Background(), "TEST_IMAGE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paid.Err = errors.New("broken")
+	if _, err := chain.Solve(context.Background(), "TEST_IMAGE"); err == nil {
+		t.Fatal("expected error when every member fails, got nil")
+	}
+}
+
+func TestVotingSolver(t *testing.T) {
+	vote := &VotingSolver{Members: []CaptchaSolver{
+		&countingSolver{Guess: CaptchaGuess{Text: "a1B2", Confidence: 1}},
+		&countingSolver{Guess: CaptchaGuess{Text: "a7B2", Confidence: 1}},
+		&countingSolver{Guess: CaptchaGuess{Text: "aIB2", Confidence: 0.5, CostUSD: 0.001}},
+		&countingSolver{Guess: CaptchaGuess{Text: "a1B2x", Confidence: 1}},
+		&countingSolver{Err: errors.New("broken")},
+	}}
+	guess, err := vote.Solve(context.Background(), "TEST_IMAGE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guess.Text != "a1B2" {
+		t.Fatalf("unexpected vote. Got %s, want a1B2", guess.Text)
+	}
+	// "1" won 1 of 2.5 weighted votes at the second position
+	if guess.Confidence < 0.39 || guess.Confidence > 0.41 {
+		t.Fatalf("unexpected confidence. Got %f, want 0.4", guess.Confidence)
+	}
+	if guess.CostUSD != 0.001 {
+		t.Fatalf("unexpected cost. Got %f, want 0.001", guess.CostUSD)
+	}
+}
+
+func TestNewSolverChain(t *testing.T) {
+	config := &AppConfig{
+		Solvers: map[string]SolverConfig{
+			"cheap-first": {Type: "chain", Members: []string{"local", "openai"}, MinConfidence: 0.8},
+			"loop":        {Type: "chain", Members: []string{"loop"}},
+			"empty":       {Type: "vote"},
+		},
+	}
+	solver, err := config.NewSolver("cheap-first")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if chain, ok := solver.(*ChainSolver); !ok || len(chain.Members) != 2 || chain.MinConfidence != 0.8 {
+		t.Fatalf("unexpected solver: %+v", solver)
+	}
+	if !config.solverNeedsOpenAIKey("cheap-first", 0) {
+		t.Fatal("expected chain to report using OpenAI")
+	}
+	for _, name := range []string{"loop", "empty"} {
+		if _, err := config.NewSolver(name); err == nil {
+			t.Fatalf(`expected error for solver "%s", got nil`, name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClass says what a caller can do about a failed request.
+type ErrorClass int
+
+const (
+	// Retrying won't help: a bad URL, a 404, a response we can't parse
+	ErrorPermanent ErrorClass = iota
+	// Worth retrying after a pause: network trouble, 5xx statuses, "Data Store Unreachable"
+	ErrorTransient
+	// The server asked us to slow down
+	ErrorRateLimited
+	// JailTracker wants a fresh captcha before it will answer
+	ErrorCaptchaRequired
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorTransient:
+		return "transient"
+	case ErrorRateLimited:
+		return "rate-limited"
+	case ErrorCaptchaRequired:
+		return "captcha-required"
+	default:
+		return "permanent"
+	}
+}
+
+// RequestError is a failed request, classified by what the caller should do about it.
+type RequestError struct {
+	Class ErrorClass
+	// HTTP status, if the server responded
+	StatusCode int
+	// How long the server asked us to wait, from its Retry-After header
+	RetryAfter time.Duration
+	Err        error
+
+	// Set once retries have been used up, so callers retrying at a higher level don't multiply them
+	exhausted bool
+	// Set if the request reached the server, or may have; see PostJSONOnce
+	sent bool
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// ClassOf returns the class of the first RequestError in err's chain.
+// Errors that weren't classified are treated as permanent.
+func ClassOf(err error) ErrorClass {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Class
+	}
+	return ErrorPermanent
+}
+
+// classifyStatus returns the class of a non-200 HTTP status.
+func classifyStatus(status int) ErrorClass {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ErrorTransient
+	default:
+		return ErrorPermanent
+	}
+}
+
+// Error messages JailTracker returns (with a 200 status) when something on their end is temporarily broken.
+// Seen in the wild: "Error 789456123: Data Store Unreachable"
+var transientErrorMessages = []string{
+	"data store unreachable",
+	"timeout",
+	"timed out",
+	"temporarily unavailable",
+}
+
+// jailTrackerError classifies a non-empty errorMessage from a JailTracker response.
+func jailTrackerError(what, message string) *RequestError {
+	class := ErrorPermanent
+	lower := strings.ToLower(message)
+	for _, transient := range transientErrorMessages {
+		if strings.Contains(lower, transient) {
+			class = ErrorTransient
+			break
+		}
+	}
+	return &RequestError{
+		Class: class,
+		Err:   fmt.Errorf(`non-empty error message for %s: "%s"`, what, message),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, in either seconds or HTTP date form.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// RetryPolicy is how often, and how patiently, transient and rate-limited failures are retried.
+type RetryPolicy struct {
+	// Total attempts, including the first
+	MaxAttempts int
+	// Delay before the first retry. Each later retry waits twice as long as the one before.
+	BaseDelay time.Duration
+	// Cap on the delay between attempts, before jitter, and on how long a Retry-After header can make us wait
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// Policy used by requestJSON and the JailTracker client. Tests shorten the delays.
+var retryPolicy = DefaultRetryPolicy
+
+// backoff returns the delay before retry number n (from 0): exponential, capped, with up to 50% added jitter.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < n && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// Do calls f until it succeeds or fails with an error that isn't transient or rate-limited,
+// sleeping between attempts. Once attempts run out, or ctx is done, the last error is returned.
+func (p RetryPolicy) Do(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 0; attempt < max(p.MaxAttempts, 1); attempt++ {
+		if attempt > 0 {
+			delay := p.backoff(attempt - 1)
+			var reqErr *RequestError
+			// Honor Retry-After, but only up to MaxDelay, so a server asking for a day doesn't stall a worker
+			if errors.As(err, &reqErr) && reqErr.RetryAfter > delay {
+				delay = max(min(reqErr.RetryAfter, p.MaxDelay), delay)
+			}
+			if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+				if errors.As(err, &reqErr) {
+					reqErr.exhausted = true
+				}
+				return fmt.Errorf("%w (stopped retrying: %w)", err, sleepErr)
+			}
+		}
+		err = f()
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || reqErr.exhausted {
+			return err
+		}
+		if reqErr.Class != ErrorTransient && reqErr.Class != ErrorRateLimited {
+			return err
+		}
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		reqErr.exhausted = true
+	}
+	return err
+}
+
+// sleepContext sleeps for d, or until ctx is done, in which case it returns ctx's error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
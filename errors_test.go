@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Real backoff delays would make tests against failing mock servers take seconds each
+	retryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	os.Exit(m.Run())
+}
+
+func TestClassifyStatus(t *testing.T) {
+	cases := []struct {
+		Status int
+		Want   ErrorClass
+	}{
+		{http.StatusTooManyRequests, ErrorRateLimited},
+		{http.StatusBadGateway, ErrorTransient},
+		{http.StatusServiceUnavailable, ErrorTransient},
+		{http.StatusRequestTimeout, ErrorTransient},
+		{http.StatusNotFound, ErrorPermanent},
+		{http.StatusBadRequest, ErrorPermanent},
+	}
+	for _, c := range cases {
+		if got := classifyStatus(c.Status); got != c.Want {
+			t.Errorf("unexpected class for status %d. Got %s, want %s", c.Status, got, c.Want)
+		}
+	}
+}
+
+func TestJailTrackerError(t *testing.T) {
+	err := jailTrackerError(`jail "x"`, "Error 789456123: Data Store Unreachable")
+	if err.Class != ErrorTransient {
+		t.Fatalf("expected Data Store Unreachable to be transient. Got %s", err.Class)
+	}
+	err = jailTrackerError(`jail "x"`, "Offender not found")
+	if err.Class != ErrorPermanent {
+		t.Fatalf("expected unknown error message to be permanent. Got %s", err.Class)
+	}
+}
+
+func TestClassOfWrapped(t *testing.T) {
+	err := fmt.Errorf("failed to update inmate: %w", &RequestError{Class: ErrorCaptchaRequired, Err: errors.New("captcha")})
+	if got := ClassOf(err); got != ErrorCaptchaRequired {
+		t.Fatalf("unexpected class. Got %s, want %s", got, ErrorCaptchaRequired)
+	}
+	if got := ClassOf(errors.New("plain")); got != ErrorPermanent {
+		t.Fatalf("expected unclassified errors to be permanent. Got %s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("3"); got != 3*time.Second {
+		t.Fatalf("unexpected delay. Got %v, want 3s", got)
+	}
+	if got := parseRetryAfter(""); got != 0 {
+		t.Fatalf("unexpected delay for missing header. Got %v", got)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got <= 0 || got > time.Minute {
+		t.Fatalf("unexpected delay for date. Got %v", got)
+	}
+}
+
+func TestRequestJSONRetries(t *testing.T) {
+	cases := []struct {
+		Label string
+		// Statuses returned by the server for each request, then 200
+		Statuses  []int
+		WantCalls int32
+		WantErr   bool
+		WantClass ErrorClass
+	}{
+		{
+			Label:     "transient failure is retried",
+			Statuses:  []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			WantCalls: 3,
+		},
+		{
+			Label:     "rate limiting is retried",
+			Statuses:  []int{http.StatusTooManyRequests},
+			WantCalls: 2,
+		},
+		{
+			Label:     "permanent failure is not retried",
+			Statuses:  []int{http.StatusNotFound},
+			WantCalls: 1,
+			WantErr:   true,
+			WantClass: ErrorPermanent,
+		},
+		{
+			Label:     "retries run out",
+			Statuses:  []int{500, 500, 500, 500},
+			WantCalls: 3,
+			WantErr:   true,
+			WantClass: ErrorTransient,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Label, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				if int(n) <= len(c.Statuses) {
+					w.WriteHeader(c.Statuses[n-1])
+					return
+				}
+				w.Write([]byte(`{"a":"ok"}`))
+			}))
+			defer ts.Close()
+
+			res := map[string]string{}
+			err := GetJSON(context.Background(), ts.URL, nil, &res)
+			if got := atomic.LoadInt32(&calls); got != c.WantCalls {
+				t.Fatalf("unexpected number of requests. Got %d, want %d", got, c.WantCalls)
+			}
+			if !c.WantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if res["a"] != "ok" {
+					t.Fatalf("unexpected response: %v", res)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := ClassOf(err); got != c.WantClass {
+				t.Fatalf("unexpected class. Got %s, want %s", got, c.WantClass)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoesNotMultiplyRetries(t *testing.T) {
+	calls := 0
+	inner := func() error {
+		calls++
+		return &RequestError{Class: ErrorTransient, Err: errors.New("down")}
+	}
+	// An outer retry around a call that already used up its retries
+	err := retryPolicy.Do(context.Background(), func() error {
+		return fmt.Errorf("wrapped: %w", retryPolicy.Do(context.Background(), inner))
+	})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if calls != retryPolicy.MaxAttempts {
+		t.Fatalf("unexpected number of attempts. Got %d, want %d", calls, retryPolicy.MaxAttempts)
+	}
+}
+
+func TestBackoffGrows(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second} {
+		got := policy.backoff(n)
+		if got < want || got > want+want/2 {
+			t.Errorf("unexpected backoff for retry %d. Got %v, want %v plus up to 50%%", n, got, want)
+		}
+	}
+}
+
+func TestRequestJSONTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	timeout := httpClient.Timeout
+	httpClient.Timeout = 20 * time.Millisecond
+	defer func() { httpClient.Timeout = timeout }()
+
+	res := map[string]string{}
+	start := time.Now()
+	err := GetJSON(context.Background(), ts.URL, nil, &res)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if ClassOf(err) != ErrorTransient {
+		t.Fatalf("expected timeout to be transient. Got %s", ClassOf(err))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request wasn't abandoned. Took %v", elapsed)
+	}
+}
+
+func TestRetryPolicyStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	calls := 0
+	err := policy.Do(ctx, func() error {
+		calls++
+		cancel()
+		return &RequestError{Class: ErrorTransient, Err: errors.New("down")}
+	})
+	if calls != 1 {
+		t.Fatalf("unexpected number of attempts. Got %d, want 1", calls)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error. Got %v", err)
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	calls := 0
+	start := time.Now()
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return &RequestError{Class: ErrorRateLimited, RetryAfter: 24 * time.Hour, Err: errors.New("slow down")}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("expected a retry. Got %d calls, %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Retry-After capped at MaxDelay. Waited %v", elapsed)
+	}
+}
+
+// unsentTransport fails its first Failures requests as if the connection was refused, before writing anything.
+type unsentTransport struct {
+	Failures int
+	calls    int
+}
+
+func (t *unsentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if t.calls <= t.Failures {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPostJSONOnce(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"a":"ok"}`))
+	}))
+	defer ts.Close()
+
+	// The server saw the request, so it isn't sent again
+	req, res := map[string]string{"code": "ABC12"}, map[string]string{}
+	err := PostJSONOnce(context.Background(), ts.URL, nil, &req, &res)
+	if ClassOf(err) != ErrorTransient || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected one request and a transient error. Got %d requests, %v", calls, err)
+	}
+
+	// Requests that never got out are retried
+	transport := httpClient.Transport
+	unsent := &unsentTransport{Failures: 2}
+	httpClient.Transport = unsent
+	defer func() { httpClient.Transport = transport }()
+	if err := PostJSONOnce(context.Background(), ts.URL, nil, &req, &res); err != nil {
+		t.Fatalf("expected the request to get through on the last attempt. Got %v", err)
+	}
+	if unsent.calls != 3 || res["a"] != "ok" {
+		t.Fatalf("unexpected attempts %d, response %v", unsent.calls, res)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// parseDay parses a YYYY-MM-DD flag value as a UTC day.
+func parseDay(value string) (time.Time, error) {
+	day, err := time.Parse(cacheDateFormat, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q; expected YYYY-MM-DD", value)
+	}
+	return day, nil
+}
+
+// findCachedJail reads a jail's snapshot for a YYYY-MM-DD UTC day, or its latest snapshot if date is empty,
+// returning it along with where it's stored.
+func findCachedJail(store SnapshotStore, slug, date string) (*Jail, string, error) {
+	if date == "" {
+		return store.Latest(slug)
+	}
+	day, err := parseDay(date)
+	if err != nil {
+		return nil, "", err
+	}
+	return store.ForDay(slug, day)
+}
+
+// runShow implements `jtt show <jail slug>`.
+func runShow(args []string) error {
+	flags := flag.NewFlagSet("show", flag.ContinueOnError)
+	addCacheFlag(flags)
+	addStorageFlag(flags)
+	date := flags.String("date", "", "UTC day of the snapshot, as YYYY-MM-DD (default latest)")
+	listInmates := flags.Bool("inmates", false, "list every inmate")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: jtt show [flags] <jail slug>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected exactly one jail slug")
+	}
+	slug := flags.Arg(0)
+	store, err := appConfig.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	jail, filename, err := findCachedJail(store, slug, *date)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(`no snapshot of "%s" in %s`, slug, store)
+	}
+	if err != nil {
+		return err
+	}
+	return printJail(os.Stdout, filename, jail, *listInmates)
+}
+
+// printJail writes a summary of a jail snapshot, optionally followed by a table of its inmates.
+func printJail(w io.Writer, filename string, jail *Jail, listInmates bool) error {
+	fetched, failed, pending := jail.FetchCounts()
+	stats := jail.CaptchaStats
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Jail\t%s\n", jail.Name)
+	fmt.Fprintf(tw, "Snapshot\t%s\n", filename)
+	fmt.Fprintf(tw, "Crawled\t%s to %s\n", jail.StartTimeUTC.Format(time.RFC3339), jail.EndTimeUTC.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Complete\t%t\n", !jail.Incomplete)
+	fmt.Fprintf(tw, "Inmates\t%d (details: %d fetched, %d failed, %d pending)\n", len(jail.Inmates), fetched, failed, pending)
+	fmt.Fprintf(tw, "Captchas\t%d accepted of %d fetched. Estimated cost: $%.4f\n", stats.Accepted, stats.Fetched, stats.EstimatedCostUSD)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !listInmates {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARREST NO\tBOOKED\tRELEASED\tFETCH\tCASES\tCHARGES\tHOLDS")
+	for _, inmate := range jail.Inmates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\n", inmate.ArrestNo, inmate.OriginalBookDateTime,
+			inmate.FinalReleaseDateTime, inmate.Fetch.Status, len(inmate.Cases), len(inmate.Charges), len(inmate.Holds))
+	}
+	return tw.Flush()
+}
+
+// runExport implements `jtt export`, which writes cached snapshots of the chosen jails as CSV or JSON.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	filter := &JailFilter{}
+	filter.addFlags(flags)
+	addCacheFlag(flags)
+	addStorageFlag(flags)
+	date := flags.String("date", "", "UTC day of the snapshots, as YYYY-MM-DD (default each jail's latest)")
+	format := flags.String("format", "csv", "csv (one row per inmate) or json (whole snapshots)")
+	out := flags.String("out", "", "file to write to (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf(`unknown format "%s"`, *format)
+	}
+	jailConfigs, err := filter.Select(appConfig)
+	if err != nil {
+		return err
+	}
+
+	store, err := appConfig.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	jails := []*Jail{}
+	inmates := 0
+	for _, jailConfig := range jailConfigs {
+		jail, _, err := findCachedJail(store, jailConfig.Slug, *date)
+		if errors.Is(err, os.ErrNotExist) {
+			if jailConfig.Usable {
+				log.Printf("No snapshot of \"%s\"; skipping", jailConfig.Slug)
+			}
+			continue
+		}
+		if errors.Is(err, errCorruptSnapshot) {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		parseFor(jail, jailConfig)
+		jails = append(jails, jail)
+		inmates += len(jail.Inmates)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(jails)
+	} else {
+		err = writeInmatesCSV(w, jails)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	log.Printf("Exported %d inmates from %d jails", inmates, len(jails))
+	return nil
+}
+
+// writeInmatesCSV writes one row per inmate, with a header row.
+// booked_at and released_at are the parsed booked and released times, in RFC 3339, or empty if unparsed.
+func writeInmatesCSV(w io.Writer, jails []*Jail) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"jail", "arrest_no", "jacket", "agency", "booked", "released",
+		"fetch_status", "cases", "charges", "holds", "charge_descriptions", "booked_at", "released_at",
+	})
+	for _, jail := range jails {
+		for _, inmate := range jail.Inmates {
+			descriptions := make([]string, 0, len(inmate.Charges))
+			for _, charge := range inmate.Charges {
+				descriptions = append(descriptions, charge.ChargeDescription)
+			}
+			cw.Write([]string{
+				jail.Name,
+				inmate.ArrestNo,
+				inmate.Jacket,
+				inmate.AgencyName,
+				inmate.OriginalBookDateTime,
+				inmate.FinalReleaseDateTime,
+				inmate.Fetch.Status,
+				strconv.Itoa(len(inmate.Cases)),
+				strconv.Itoa(len(inmate.Charges)),
+				strconv.Itoa(len(inmate.Holds)),
+				strings.Join(descriptions, "; "),
+				formatParsedTime(inmate.Times.OriginalBookDateTime),
+				formatParsedTime(inmate.Times.FinalReleaseDateTime),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatParsedTime formats a parsed time for export, or returns "" if there's none.
+func formatParsedTime(p *ParsedTime) string {
+	if t := parsedTimeValue(p); t != nil {
+		return t.Format(time.RFC3339)
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// JailFilter picks jails from the config, from command line flags or from a named group in AppConfig.Groups.
+// Each kind of criterion that's set must match, and within a kind any value may match.
+// An empty filter picks every jail.
+type JailFilter struct {
+	// Slugs or glob patterns, like "*_County_Ms"; see path.Match
+	Slugs []string
+	// Two-letter states, in any case
+	States []string
+	// Jails with any of these tags; see JailConfig.Tags
+	Tags []string
+	// Only jails that failed the last time they were run
+	FailedLastRun bool
+	// Only jails in at least one of these groups from AppConfig.Groups. Groups can't include other groups.
+	Groups []string
+}
+
+func (f *JailFilter) addFlags(flags *flag.FlagSet) {
+	flags.Var((*stringList)(&f.Slugs), "jail", "only jails with this slug, or matching this glob like '*_Ms' (repeatable, or comma-separated)")
+	flags.Var((*stringList)(&f.States), "state", "only jails in this state, like MS (repeatable, or comma-separated)")
+	flags.Var((*stringList)(&f.Tags), "tag", "only jails with this tag (repeatable, or comma-separated)")
+	flags.Var((*stringList)(&f.Groups), "group", "only jails in this group from the config (repeatable, or comma-separated)")
+	flags.BoolVar(&f.FailedLastRun, "failed", false, "only jails that failed the last time they were run")
+}
+
+// IsEmpty returns whether the filter picks every jail.
+func (f *JailFilter) IsEmpty() bool {
+	return len(f.Slugs) == 0 && len(f.States) == 0 && len(f.Tags) == 0 && !f.FailedLastRun && len(f.Groups) == 0
+}
+
+// validate checks the filter's slug patterns.
+func (f *JailFilter) validate() error {
+	for _, pattern := range f.Slugs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf(`bad jail pattern "%s": %w`, pattern, err)
+		}
+	}
+	return nil
+}
+
+// match returns whether the jail meets the filter's own criteria, ignoring Groups.
+// failed holds the slugs of jails that failed last run, if FailedLastRun is set.
+func (f *JailFilter) match(jailConfig *JailConfig, failed map[string]bool) bool {
+	if len(f.Slugs) > 0 && !matchesAnyPattern(f.Slugs, jailConfig.Slug) {
+		return false
+	}
+	if len(f.States) > 0 && !containsFold(f.States, jailConfig.State) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		tagged := false
+		for _, tag := range jailConfig.Tags {
+			tagged = tagged || containsFold(f.Tags, tag)
+		}
+		if !tagged {
+			return false
+		}
+	}
+	if f.FailedLastRun && !failed[jailConfig.Slug] {
+		return false
+	}
+	return true
+}
+
+// Select returns the jails the filter picks, in config order.
+// A slug or pattern matching no jail is an error, since it's probably a typo, as is an unknown group.
+func (f *JailFilter) Select(config *AppConfig) ([]*JailConfig, error) {
+	filters := []*JailFilter{f}
+	groups := make([]*JailFilter, 0, len(f.Groups))
+	for _, name := range f.Groups {
+		group, ok := config.Groups[name]
+		if !ok {
+			return nil, fmt.Errorf(`unknown group "%s"`, name)
+		}
+		groups = append(groups, &group)
+	}
+	filters = append(filters, groups...)
+
+	var failed map[string]bool
+	for _, filter := range filters {
+		if err := filter.validate(); err != nil {
+			return nil, err
+		}
+		if filter.FailedLastRun && failed == nil {
+			var err error
+			failed, err = failedLastRun(config.Cache)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var selected []*JailConfig
+	for i := range config.Jails {
+		jailConfig := &config.Jails[i]
+		if !f.match(jailConfig, failed) {
+			continue
+		}
+		inGroup := len(groups) == 0
+		for _, group := range groups {
+			inGroup = inGroup || group.match(jailConfig, failed)
+		}
+		if inGroup {
+			selected = append(selected, jailConfig)
+		}
+	}
+
+	for _, pattern := range f.Slugs {
+		known := false
+		for i := range config.Jails {
+			known = known || matchesAnyPattern([]string{pattern}, config.Jails[i].Slug)
+		}
+		if !known {
+			return nil, fmt.Errorf(`unknown jail "%s"`, pattern)
+		}
+	}
+	return selected, nil
+}
+
+// failedLastRun returns the slugs of jails that failed the last time they were run, per the run reports in dir.
+func failedLastRun(dir string) (map[string]bool, error) {
+	reports, err := LatestJailReports(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no run report in %s, so no jails have failed yet", dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]bool{}
+	for _, jail := range reports {
+		if jail.Outcome == OutcomeFailed {
+			failed[jail.Slug] = true
+		}
+	}
+	return failed, nil
+}
+
+// matchesAnyPattern reports whether s matches any of the glob patterns. Bad patterns never match.
+func matchesAnyPattern(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
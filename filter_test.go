@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJailFilterSelect(t *testing.T) {
+	cache := t.TempDir()
+	lastRun := &RunReport{
+		StartTimeUTC: time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC),
+		Jails: []JailReport{
+			{Slug: "Marion_County_Ms", Outcome: OutcomeCrawled},
+			{Slug: "Greenwood_County_SC", Outcome: OutcomeFailed},
+		},
+	}
+	if _, err := lastRun.Save(cache); err != nil {
+		t.Fatal(err)
+	}
+	// An older run, in which Marion failed, shouldn't count
+	olderRun := &RunReport{
+		StartTimeUTC: lastRun.StartTimeUTC.Add(-24 * time.Hour),
+		Jails:        []JailReport{{Slug: "Marion_County_Ms", Outcome: OutcomeFailed}},
+	}
+	if _, err := olderRun.Save(cache); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &AppConfig{
+		Cache: cache,
+		Jails: []JailConfig{
+			{Slug: "Marion_County_Ms", State: "MS", Usable: true, Tags: []string{"gulf"}},
+			{Slug: "Perry_County_Ms", State: "MS", Tags: []string{"Flaky"}},
+			{Slug: "Greenwood_County_SC", State: "SC", Usable: true, Tags: []string{"flaky"}},
+		},
+		Groups: map[string]JailFilter{
+			"mississippi": {States: []string{"MS"}},
+			"flaky":       {Tags: []string{"flaky"}},
+			"retry":       {FailedLastRun: true},
+		},
+	}
+	tests := []struct {
+		Name   string
+		Args   []string
+		Want   []string
+		ErrMsg string
+	}{
+		{"empty picks all", nil, []string{"Marion_County_Ms", "Perry_County_Ms", "Greenwood_County_SC"}, ""},
+		{"by slug", []string{"-jail", "Greenwood_County_SC"}, []string{"Greenwood_County_SC"}, ""},
+		{"comma-separated slugs", []string{"-jail", "Perry_County_Ms,Marion_County_Ms"}, []string{"Marion_County_Ms", "Perry_County_Ms"}, ""},
+		{"slug glob", []string{"-jail", "*_Ms"}, []string{"Marion_County_Ms", "Perry_County_Ms"}, ""},
+		{"state ignores case", []string{"-state", "ms"}, []string{"Marion_County_Ms", "Perry_County_Ms"}, ""},
+		{"slug and state", []string{"-jail", "Greenwood_County_SC", "-state", "MS"}, nil, ""},
+		{"tag ignores case", []string{"-tag", "flaky"}, []string{"Perry_County_Ms", "Greenwood_County_SC"}, ""},
+		{"failed last run", []string{"-failed"}, []string{"Greenwood_County_SC"}, ""},
+		{"group", []string{"-group", "mississippi"}, []string{"Marion_County_Ms", "Perry_County_Ms"}, ""},
+		{"any of several groups", []string{"-group", "retry,mississippi"}, []string{"Marion_County_Ms", "Perry_County_Ms", "Greenwood_County_SC"}, ""},
+		{"group and flag", []string{"-group", "flaky", "-state", "SC"}, []string{"Greenwood_County_SC"}, ""},
+		{"unknown slug", []string{"-jail", "Nowhere"}, nil, `unknown jail "Nowhere"`},
+		{"glob matching nothing", []string{"-jail", "*_TX"}, nil, `unknown jail "*_TX"`},
+		{"bad glob", []string{"-jail", "[Marion"}, nil, `bad jail pattern "[Marion": syntax error in pattern`},
+		{"unknown group", []string{"-group", "texas"}, nil, `unknown group "texas"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			filter := &JailFilter{}
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			filter.addFlags(flags)
+			if err := flags.Parse(tt.Args); err != nil {
+				t.Fatal(err)
+			}
+			selected, err := filter.Select(config)
+			if tt.ErrMsg != "" {
+				if err == nil || err.Error() != tt.ErrMsg {
+					t.Fatalf("unexpected error. Got %v, want %s", err, tt.ErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, jailConfig := range selected {
+				got = append(got, jailConfig.Slug)
+			}
+			if !reflect.DeepEqual(got, tt.Want) {
+				t.Fatalf("unexpected jails. Got %v, want %v", got, tt.Want)
+			}
+		})
+	}
+}
+
+func TestJailFilterFailedWithoutReport(t *testing.T) {
+	config := &AppConfig{Cache: t.TempDir(), Jails: []JailConfig{{Slug: "a"}}}
+	filter := &JailFilter{FailedLastRun: true}
+	if _, err := filter.Select(config); err == nil {
+		t.Fatal("expected error without a run report")
+	}
+}
+
+func TestFailedLastRunKeepsJailsAFilteredRunSkipped(t *testing.T) {
+	cache := t.TempDir()
+	nightly := time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC)
+	reports := []*RunReport{
+		{StartTimeUTC: nightly, Jails: []JailReport{
+			{Slug: "a", Outcome: OutcomeFailed},
+			{Slug: "b", Outcome: OutcomeFailed},
+			{Slug: "c", Outcome: OutcomeCrawled},
+		}},
+		// Debugging one jail with `crawl -jail a`
+		{StartTimeUTC: nightly.Add(2 * time.Hour), Jails: []JailReport{{Slug: "a", Outcome: OutcomeCrawled}}},
+		// Interrupted before c was started, which says nothing about how c is doing
+		{StartTimeUTC: nightly.Add(3 * time.Hour), Interrupted: true, Jails: []JailReport{{Slug: "c", Outcome: OutcomeNotRun}}},
+	}
+	for _, report := range reports {
+		if _, err := report.Save(cache); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failed, err := failedLastRun(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"b": true}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("unexpected failed jails. Got %v, want %v", failed, want)
+	}
+}
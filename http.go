@@ -2,44 +2,97 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"time"
 )
 
+// Longest a single request may take, including reading the response, before it's abandoned (and maybe retried).
+// A hung JailTracker socket would otherwise stall a crawl forever.
+const DefaultRequestTimeout = 30 * time.Second
+
+// Client for every JSON request. main sets the timeout from config.
+var httpClient = &http.Client{Timeout: DefaultRequestTimeout}
+
 // GetJSON makes a GET request to url, then unmarshals the response body from JSON.
 // Additional headers can be passed as a map.
-func GetJSON[Res interface{}](url string, headers map[string][]string, responseBody *Res) error {
-	return requestJSON[interface{}, Res]("GET", url, headers, nil, responseBody)
+func GetJSON[Res interface{}](ctx context.Context, url string, headers map[string][]string, responseBody *Res) error {
+	return requestJSON[interface{}, Res](ctx, "GET", url, headers, nil, responseBody)
 }
 
 // PostJSON makes a POST request to url, marshaling the request body to JSON and unmarshaling the response body from JSON.
 // Method is set by argument, and additional headers can be passed as a map.
-func PostJSON[Req interface{}, Res interface{}](url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
-	return requestJSON[Req, Res]("POST", url, headers, requestBody, responseBody)
+func PostJSON[Req interface{}, Res interface{}](ctx context.Context, url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
+	return requestJSON[Req, Res](ctx, "POST", url, headers, requestBody, responseBody)
+}
+
+// PostJSONOnce is PostJSON for requests that mustn't be repeated once the server may have seen them,
+// like validating a captcha. Only failures to send the request at all, like a refused connection, are retried.
+func PostJSONOnce[Req interface{}, Res interface{}](ctx context.Context, url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
+	return requestJSONOnce[Req, Res](ctx, "POST", url, headers, requestBody, responseBody)
 }
 
 // requestJSON makes an HTTP request, marshaling the request body to JSON and unmarshaling the response body from JSON.
 // Method is set by argument, and additional headers can be passed as a map.
 // For GET requests, Req should be interface{} and requestBody should be nil.
-func requestJSON[Req interface{}, Res interface{}](method string, url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
-	var req *http.Request
-	var err error
+// Transient and rate-limited failures are retried according to retryPolicy, until ctx is done.
+// Failures are returned as a *RequestError; see ClassOf.
+func requestJSON[Req interface{}, Res interface{}](ctx context.Context, method string, url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
+	payloadJson, err := marshalRequestBody(requestBody)
+	if err != nil {
+		return err
+	}
+	return retryPolicy.Do(ctx, func() error {
+		return doRequestJSON(ctx, method, url, headers, payloadJson, responseBody)
+	})
+}
 
-	if requestBody != nil { // If payload provided, marshal to JSON. Should be missing for GET.
-		// Don't shadow outer err in next assignment
-		payloadJson, marshalErr := json.Marshal(requestBody)
-		if marshalErr != nil {
-			return fmt.Errorf("failed to marshal request body to JSON: %w", err)
+// requestJSONOnce is requestJSON, except that failures are only retried if the request was never sent.
+func requestJSONOnce[Req interface{}, Res interface{}](ctx context.Context, method string, url string, headers map[string][]string, requestBody *Req, responseBody *Res) error {
+	payloadJson, err := marshalRequestBody(requestBody)
+	if err != nil {
+		return err
+	}
+	return retryPolicy.Do(ctx, func() error {
+		err := doRequestJSON(ctx, method, url, headers, payloadJson, responseBody)
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) && reqErr.sent {
+			// The server may have acted on it, so stop here, keeping the class for the caller
+			reqErr.exhausted = true
 		}
-		req, err = http.NewRequest(method, url, bytes.NewBuffer(payloadJson))
-	} else { // Probably a GET
-		req, err = http.NewRequest(method, url, nil)
+		return err
+	})
+}
+
+// marshalRequestBody marshals a request body to JSON, if there is one. It should be nil for GET.
+func marshalRequestBody[Req interface{}](requestBody *Req) ([]byte, error) {
+	if requestBody == nil {
+		return nil, nil
+	}
+	payloadJson, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("failed to marshal request body to JSON: %w", err)}
 	}
+	return payloadJson, nil
+}
 
+// doRequestJSON makes a single attempt at a request for requestJSON.
+func doRequestJSON[Res interface{}](ctx context.Context, method string, url string, headers map[string][]string, payloadJson []byte, responseBody *Res) error {
+	var body io.Reader
+	if payloadJson != nil {
+		body = bytes.NewReader(payloadJson)
+	}
+	// Whether any of the request was written, so the server may have seen it
+	sent := false
+	trace := &httptrace.ClientTrace{WroteRequest: func(httptrace.WroteRequestInfo) { sent = true }}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("failed to create request: %w", err)}
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	// Set any extra headers
@@ -47,23 +100,40 @@ func requestJSON[Req interface{}, Res interface{}](method string, url string, he
 		req.Header[k] = v
 	}
 
-	// Make request
-	res, err := http.DefaultClient.Do(req)
+	// Make request, once the host's rate limit allows
+	if err := waitForHost(ctx, url); err != nil {
+		return &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("request abandoned: %w", err)}
+	}
+	res, err := httpClient.Do(req)
+	if ctx.Err() != nil {
+		// Cancelled or out of time; no point retrying
+		return &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("request failed: %w", ctx.Err())}
+	}
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		// Connection refused or reset, DNS hiccups, timeouts: all worth another try
+		return &RequestError{Class: ErrorTransient, Err: fmt.Errorf("request failed: %w", err), sent: sent}
 	}
 
 	defer res.Body.Close()
 	if res.StatusCode != 200 {
-		return fmt.Errorf("got non-200 status: %d", res.StatusCode)
+		return &RequestError{
+			Class:      classifyStatus(res.StatusCode),
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("got non-200 status: %d", res.StatusCode),
+			sent:       true,
+		}
+	}
+	data, err := io.ReadAll(res.Body)
+	if ctx.Err() != nil {
+		return &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("failed to read response body: %w", ctx.Err())}
 	}
-	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return &RequestError{Class: ErrorTransient, Err: fmt.Errorf("failed to read response body: %w", err), sent: true}
 	}
-	err = json.Unmarshal(body, responseBody)
+	err = json.Unmarshal(data, responseBody)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal response body: %w", err)
+		return &RequestError{Class: ErrorPermanent, Err: fmt.Errorf("failed to unmarshal response body: %w", err)}
 	}
 
 	return nil
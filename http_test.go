@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -92,7 +93,7 @@ func TestPostJSON(t *testing.T) {
 			wantRes = &c.WantRes
 			res = &Res{}
 
-			err := PostJSON[Req, Res](ts.URL, nil, req, res)
+			err := PostJSON[Req, Res](context.Background(), ts.URL, nil, req, res)
 			if !c.WantErr && err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
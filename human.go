@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHumanTimeout = 2 * time.Minute
+	DefaultHumanAddr    = "127.0.0.1:8787"
+)
+
+// Only one person is answering, so only one captcha is shown at a time, across all jails.
+var humanMu sync.Mutex
+
+// HumanSolver asks a person to read the captcha, either at the terminal or on a local web page.
+// It's slow, but it can push a stubborn jail through when automated solvers keep failing.
+type HumanSolver struct {
+	// "terminal" writes the image to a temporary file and reads the answer from standard input.
+	// "web" serves the image and an answer form on Addr.
+	Mode string
+	// Address for the web page
+	Addr string
+	// How long to wait for an answer
+	Timeout time.Duration
+
+	// Where terminal answers come from, and prompts go
+	input  *lineReader
+	output io.Writer
+}
+
+// NewHumanSolver returns a solver using standard input and output for the terminal mode.
+func NewHumanSolver(mode string) (*HumanSolver, error) {
+	if mode == "" {
+		mode = "terminal"
+	}
+	if mode != "terminal" && mode != "web" {
+		return nil, fmt.Errorf(`unknown human solver mode "%s"`, mode)
+	}
+	return &HumanSolver{
+		Mode:    mode,
+		Addr:    DefaultHumanAddr,
+		Timeout: DefaultHumanTimeout,
+		input:   stdinLines,
+		output:  os.Stderr,
+	}, nil
+}
+
+// Solve shows the captcha and waits for an answer. An empty answer skips the captcha.
+func (h *HumanSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	humanMu.Lock()
+	defer humanMu.Unlock()
+
+	var answer string
+	var err error
+	if h.Mode == "web" {
+		answer, err = h.solveWeb(ctx, inlineImage)
+	} else {
+		answer, err = h.solveTerminal(ctx, inlineImage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil, errors.New("captcha skipped")
+	}
+	return &CaptchaGuess{
+		Text:       answer,
+		Confidence: 1,
+		Solver:     "human",
+	}, nil
+}
+
+func (h *HumanSolver) solveTerminal(ctx context.Context, inlineImage string) (string, error) {
+	data, err := decodeInlineImageBytes(inlineImage)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp("", "jtt-captcha-*.gif")
+	if err != nil {
+		return "", fmt.Errorf("failed to create captcha image file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to write captcha image file: %w", err)
+	}
+
+	// Anything typed before the prompt was meant for an earlier captcha
+	h.input.drain()
+	fmt.Fprintf(h.output, "Captcha image saved to %s\nType the text in the image within %v (blank to skip): ",
+		file.Name(), h.Timeout)
+	return h.input.readLine(ctx, h.Timeout)
+}
+
+func (h *HumanSolver) solveWeb(ctx context.Context, inlineImage string) (string, error) {
+	// The image is embedded in the page as-is, so make sure it's only an image
+	if !strings.HasPrefix(inlineImage, "data:image/") {
+		return "", errors.New("captcha image is not an inline image")
+	}
+	page, err := startHumanWebPage(h.Addr)
+	if err != nil {
+		return "", err
+	}
+	answers := page.show(inlineImage)
+	defer page.clear()
+	log.Printf("Captcha waiting for an answer at http://%s/ (timeout %v)", h.Addr, h.Timeout)
+	select {
+	case answer := <-answers:
+		return answer, nil
+	case <-time.After(h.Timeout):
+		return "", fmt.Errorf("no answer within %v", h.Timeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// lineReader delivers lines from a reader over a channel, so that reads can time out.
+// The goroutine reading is started on first use and never stops, since a blocked read can't be cancelled.
+type lineReader struct {
+	in    io.Reader
+	lines chan string
+	once  sync.Once
+}
+
+var stdinLines = newLineReader(os.Stdin)
+
+func newLineReader(in io.Reader) *lineReader {
+	return &lineReader{in: in, lines: make(chan string, 1)}
+}
+
+func (r *lineReader) start() {
+	r.once.Do(func() {
+		go func() {
+			scanner := bufio.NewScanner(r.in)
+			for scanner.Scan() {
+				r.lines <- scanner.Text()
+			}
+			close(r.lines)
+		}()
+	})
+}
+
+// drain discards lines that have already been read.
+func (r *lineReader) drain() {
+	r.start()
+	for {
+		select {
+		case _, ok := <-r.lines:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *lineReader) readLine(ctx context.Context, timeout time.Duration) (string, error) {
+	r.start()
+	select {
+	case line, ok := <-r.lines:
+		if !ok {
+			return "", errors.New("input closed")
+		}
+		return line, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("no answer within %v", timeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+var humanPageTemplate = template.Must(template.New("captcha").Parse(`<!DOCTYPE html>
+<html>
+<head><title>JTT captcha</title>{{if not .Image}}<meta http-equiv="refresh" content="2">{{end}}</head>
+<body>
+{{if .Image}}
+<img src="{{.Image}}" alt="captcha" style="height: 100px">
+<form method="post" action="/solve">
+<input type="hidden" name="id" value="{{.ID}}">
+<input name="answer" autofocus autocomplete="off">
+<button type="submit">Submit</button>
+</form>
+{{else}}
+<p>No captcha waiting. This page refreshes itself.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// humanWebPage serves whichever captcha is currently waiting for an answer.
+type humanWebPage struct {
+	mu      sync.Mutex
+	id      int
+	image   string
+	answers chan string
+}
+
+var (
+	humanPagesMu sync.Mutex
+	humanPages   = map[string]*humanWebPage{}
+)
+
+// startHumanWebPage starts serving on addr, if not already started.
+func startHumanWebPage(addr string) (*humanWebPage, error) {
+	humanPagesMu.Lock()
+	defer humanPagesMu.Unlock()
+	if page, ok := humanPages[addr]; ok {
+		return page, nil
+	}
+	page := &humanWebPage{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", page.handleIndex)
+	mux.HandleFunc("/solve", page.handleSolve)
+	server := &http.Server{Addr: addr, Handler: mux}
+	// Listen now, so a bad address is reported to the caller rather than logged later
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve captcha page: %w", err)
+	}
+	go func() {
+		err := server.Serve(listener)
+		log.Printf("captcha page on %s stopped: %v", addr, err)
+	}()
+	humanPages[addr] = page
+	return page, nil
+}
+
+// show makes the image the current captcha, returning a channel for its answer.
+func (p *humanWebPage) show(inlineImage string) <-chan string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.id++
+	p.image = inlineImage
+	p.answers = make(chan string, 1)
+	return p.answers
+}
+
+func (p *humanWebPage) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.image = ""
+	p.answers = nil
+}
+
+func (p *humanWebPage) handleIndex(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	data := struct {
+		ID    int
+		Image template.URL
+	}{p.id, template.URL(p.image)}
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	humanPageTemplate.Execute(w, data)
+}
+
+func (p *humanWebPage) handleSolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p.mu.Lock()
+	// Ignore answers to a captcha that has since timed out or been replaced
+	if p.answers != nil && r.FormValue("id") == fmt.Sprint(p.id) {
+		p.answers <- r.FormValue("answer")
+		p.answers = nil
+	}
+	p.mu.Unlock()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
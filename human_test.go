@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHumanSolverTerminal(t *testing.T) {
+	image := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	var output bytes.Buffer
+	solver := &HumanSolver{
+		Mode:    "terminal",
+		Timeout: time.Second,
+		input:   newLineReader(strings.NewReader(" a1B2 \n\n")),
+		output:  &output,
+	}
+	guess, err := solver.Solve(context.Background(), image)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guess.Text != "a1B2" || guess.Solver != "human" {
+		t.Fatalf("unexpected guess: %+v", guess)
+	}
+	if !strings.Contains(output.String(), "jtt-captcha-") {
+		t.Fatalf("expected prompt to include image path. Got %s", output.String())
+	}
+
+	// Input is consumed by drain before the next prompt, leaving nothing to read
+	if _, err := solver.Solve(context.Background(), image); err == nil {
+		t.Fatal("expected error with no answer, got nil")
+	}
+}
+
+func TestHumanSolverTimeout(t *testing.T) {
+	// A pipe that's never written to blocks forever
+	r, w := io.Pipe()
+	defer w.Close()
+	solver := &HumanSolver{
+		Mode:    "terminal",
+		Timeout: 10 * time.Millisecond,
+		input:   newLineReader(r),
+		output:  io.Discard,
+	}
+	image := "data:image/gif;base64," + base64.StdEncoding.EncodeToString([]byte("GIF89a"))
+	if _, err := solver.Solve(context.Background(), image); err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+}
+
+func TestHumanWebPage(t *testing.T) {
+	page := &humanWebPage{}
+	answers := page.show("data:image/gif;base64,R0lGODlh")
+
+	res := httptest.NewRecorder()
+	page.handleIndex(res, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(res.Body.String(), `src="data:image/gif;base64,R0lGODlh"`) {
+		t.Fatalf("expected page to show captcha. Got %s", res.Body.String())
+	}
+
+	post := func(id string) {
+		form := url.Values{"id": {id}, "answer": {"a1B2"}}
+		req := httptest.NewRequest("POST", "/solve", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		page.handleSolve(res, req)
+		if res.Code != http.StatusSeeOther {
+			t.Fatalf("unexpected status. Got %d, want %d", res.Code, http.StatusSeeOther)
+		}
+	}
+	// Answer for a stale captcha is ignored
+	post("0")
+	select {
+	case answer := <-answers:
+		t.Fatalf("unexpected answer for stale captcha: %s", answer)
+	default:
+	}
+	post("1")
+	select {
+	case answer := <-answers:
+		if answer != "a1B2" {
+			t.Fatalf("unexpected answer. Got %s, want a1B2", answer)
+		}
+	default:
+		t.Fatal("expected an answer")
+	}
+}
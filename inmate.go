@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"time"
 )
 
 type Case struct {
@@ -13,6 +15,10 @@ type Case struct {
 	FineAmount float64 `json:"fineAmount"`
 	Sentence   string  `json:"sentence"`  // "0y 0m 0d"
 	CourtTime  string  `json:"courtTime"` // "Jul 10 2024 9:00AM"
+
+	// Parsed from the fields above; see Jail.Parse. Not part of JailTracker's response.
+	Times  CaseTimes  `json:"times"`
+	Values CaseValues `json:"values"`
 }
 
 // Currently lack type data for certain fields
@@ -51,6 +57,10 @@ type Charge struct {
 	ArrestDate string `json:"arrestDate"`
 	// "arrestingAgency": "Circuit Court"
 	ArrestingAgency string `json:"arrestingAgency"`
+
+	// Parsed from the fields above; see Jail.Parse. Not part of JailTracker's response.
+	Times  ChargeTimes  `json:"times"`
+	Values ChargeValues `json:"values"`
 }
 
 // Currently lack data
@@ -103,9 +113,8 @@ type Inmate struct {
 	// "Sched Release" (date?)
 	SpecialSchedRelease string `json:"specialSchedRelease"`
 	// "Booking Date" (datetime "6/28/2024 10:22:44 AM"; differs from OriginalBookDateTime)
-	// Note that this is probably set whenever OriginalBookDateTime is set,
-	// so if this isn't set, we probably failed to get the individual inmate info.
-	// (In which case we may incorrectly see 0 charges.)
+	// This is probably set whenever OriginalBookDateTime is set, but don't rely on it to tell whether
+	// the individual inmate info was fetched; see Fetch.
 	SpecialBookingDate string `json:"specialBookingDate"`
 	// "Date Released" (date?)
 	SpecialDateReleased string `json:"specialDateReleased"`
@@ -115,9 +124,63 @@ type Inmate struct {
 	SpecialArrestingAgency string `json:"specialArrestingAgency"`
 	// "Arresting Officer" (string "SOME NAME")
 	SpecialArrestingOfficer string `json:"specialArrestingOfficer"`
+
+	// Parsed from the timestamps above; see Jail.Parse. Not part of JailTracker's response.
+	Times InmateTimes `json:"times"`
+
+	// How fetching the per-inmate details went. Not part of JailTracker's response.
+	// Unless Fetch.Status is FetchOK, zero charges means we don't know the charges, not that there are none.
+	Fetch InmateFetch `json:"fetch"`
+}
+
+// Statuses for InmateFetch. Snapshots from before fetches were tracked have an empty status.
+const (
+	// Listed, but details not requested yet
+	FetchPending = "pending"
+	// Details fetched
+	FetchOK = "ok"
+	// Details requested, but the last attempt failed
+	FetchFailed = "failed"
+)
+
+// InmateFetch records attempts to fetch an inmate's details.
+type InmateFetch struct {
+	Status string `json:"status"`
+	// Calls to Inmate.Update, including those from earlier runs of a resumed crawl.
+	// Retries within a call aren't counted.
+	Attempts int `json:"attempts"`
+	// Error from the last failed attempt, and its ErrorClass. Cleared on success.
+	LastError      string `json:"lastError,omitempty"`
+	LastErrorClass string `json:"lastErrorClass,omitempty"`
+	// When the details were fetched
+	FetchedAtUTC *time.Time `json:"fetchedAtUTC,omitempty"`
 }
 
-func (i *Inmate) Update(j *Jail) error {
+// DetailFetched returns whether the inmate's details have been fetched.
+func (i *Inmate) DetailFetched() bool {
+	return i.Fetch.Status == FetchOK
+}
+
+// Update fetches the inmate's details, recording the outcome in i.Fetch.
+func (i *Inmate) Update(ctx context.Context, j *Jail) error {
+	i.Fetch.Attempts++
+	err := i.update(ctx, j)
+	if err != nil {
+		i.Fetch.Status = FetchFailed
+		i.Fetch.LastError = err.Error()
+		i.Fetch.LastErrorClass = ClassOf(err).String()
+		return err
+	}
+	now := time.Now().UTC()
+	i.Fetch = InmateFetch{
+		Status:       FetchOK,
+		Attempts:     i.Fetch.Attempts,
+		FetchedAtUTC: &now,
+	}
+	return nil
+}
+
+func (i *Inmate) update(ctx context.Context, j *Jail) error {
 	//"<OMS_URL>/jtclientweb/Offender/<JAIL_NAME>/<ARREST_NO>/offenderbucket/<OFFENDER_VIEW_KEY>",
 	inmateURL := fmt.Sprintf("%s/jtclientweb/Offender/%s/%s/offenderbucket/%d",
 		j.BaseURL,
@@ -125,36 +188,29 @@ func (i *Inmate) Update(j *Jail) error {
 		i.ArrestNo,
 		j.OffenderViewKey,
 	)
-	payload := &CaptchaProtocol{
-		CaptchaKey:   j.CaptchaKey,
-		CaptchaImage: "",
-		UserCode:     "",
-	}
-	inmateResponse := &InmateResponse{}
+	var inmateResponse *InmateResponse
 
 	// We can only make so many requests for data before we need to solve a captcha again.
 	// Here, we try to solve the captcha and then retry the request once.
 	// (Note: this seems to not always be the case, but it's not clear to me what triggers it.
 	// Sometimes I immediately get captcha'd every 5 requests, sometimes it's only on the first one.)
 	for attempt := 0; attempt < 2; attempt++ {
-		err := PostJSON[CaptchaProtocol, InmateResponse](inmateURL, nil, payload, inmateResponse)
-		if err != nil {
-			return fmt.Errorf("failed to update inmate: %w", err)
-		}
-		if inmateResponse.ErrorMessage != "" {
-			return fmt.Errorf(`non-empty error message for inmate "%s": "%s"`, i.ArrestNo, inmateResponse.ErrorMessage)
-		}
-		if !inmateResponse.CaptchaRequired { // Success!
+		var err error
+		inmateResponse, err = i.request(ctx, j, inmateURL)
+		if err == nil { // Success!
 			break
 		}
+		if ClassOf(err) != ErrorCaptchaRequired {
+			return err
+		}
 		if attempt == 0 { // Try to refresh captcha
-			log.Printf("Captcha required for inmate \"%s\"; refreshing", i.ArrestNo)
-			err = j.updateCaptcha()
+			j.logf("Captcha required for inmate \"%s\"; refreshing", i.ArrestNo)
+			err = j.updateCaptcha(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to update inmate due to failed captcha: %w", err)
 			}
 		} else { // Already retried
-			return fmt.Errorf("captcha required for inmate after refresh. Response: %v", inmateResponse)
+			return fmt.Errorf("captcha required for inmate after refresh: %w", err)
 		}
 	}
 
@@ -184,3 +240,32 @@ func (i *Inmate) Update(j *Jail) error {
 
 	return nil
 }
+
+// request requests the inmate's data, retrying JailTracker's transient errors.
+// The captcha key is read from the jail on each attempt, since it changes when the captcha is refreshed.
+func (i *Inmate) request(ctx context.Context, j *Jail, inmateURL string) (*InmateResponse, error) {
+	var inmateResponse *InmateResponse
+	err := retryPolicy.Do(ctx, func() error {
+		payload := &CaptchaProtocol{
+			CaptchaKey:   j.CaptchaKey,
+			CaptchaImage: "",
+			UserCode:     "",
+		}
+		inmateResponse = &InmateResponse{}
+		err := PostJSON[CaptchaProtocol, InmateResponse](ctx, inmateURL, nil, payload, inmateResponse)
+		if err != nil {
+			return fmt.Errorf("failed to update inmate: %w", err)
+		}
+		if inmateResponse.ErrorMessage != "" {
+			return jailTrackerError(fmt.Sprintf(`inmate "%s"`, i.ArrestNo), inmateResponse.ErrorMessage)
+		}
+		if inmateResponse.CaptchaRequired {
+			return &RequestError{Class: ErrorCaptchaRequired, Err: errors.New("captcha required for inmate")}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inmateResponse, nil
+}
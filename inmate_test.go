@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newMockJailTracker serves captchas that always match, and answers inmate requests from responses in order,
+// repeating the last one.
+func newMockJailTracker(t *testing.T, responses []InmateResponse) (*httptest.Server, *int32) {
+	var calls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jtclientweb/captcha/getnewcaptchaclient", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"captchaKey":"FRESH_KEY","captchaImage":"TEST_IMAGE","userCode":null}`))
+	})
+	mux.HandleFunc("/jtclientweb/Captcha/validatecaptcha", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"captchaMatched":true,"captchaKey":"FRESH_KEY"}`))
+	})
+	mux.HandleFunc("/jtclientweb/Offender/test/A1/offenderbucket/7", func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		response := responses[min(n, len(responses))-1]
+		data, err := json.Marshal(response)
+		if err != nil {
+			t.Errorf("failed to marshal response: %v", err)
+		}
+		w.Write(data)
+	})
+	return httptest.NewServer(mux), &calls
+}
+
+func TestInmateUpdate(t *testing.T) {
+	success := InmateResponse{
+		Success:         true,
+		OffenderViewKey: 8,
+		Charges:         []Charge{{ChargeDescription: "TRESPASS"}},
+	}
+	cases := []struct {
+		Label     string
+		Responses []InmateResponse
+		WantCalls int32
+		WantErr   bool
+		WantClass ErrorClass
+	}{
+		{
+			Label:     "happy path",
+			Responses: []InmateResponse{success},
+			WantCalls: 1,
+		},
+		{
+			Label: "data store unreachable is retried",
+			Responses: []InmateResponse{
+				{ErrorMessage: "Error 789456123: Data Store Unreachable"},
+				success,
+			},
+			WantCalls: 2,
+		},
+		{
+			Label:     "unknown error message is not retried",
+			Responses: []InmateResponse{{ErrorMessage: "Something odd"}},
+			WantCalls: 1,
+			WantErr:   true,
+			WantClass: ErrorPermanent,
+		},
+		{
+			Label:     "captcha required refreshes captcha once",
+			Responses: []InmateResponse{{CaptchaRequired: true}, success},
+			WantCalls: 2,
+		},
+		{
+			Label:     "captcha still required after refresh",
+			Responses: []InmateResponse{{CaptchaRequired: true}},
+			WantCalls: 2,
+			WantErr:   true,
+			WantClass: ErrorCaptchaRequired,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Label, func(t *testing.T) {
+			server, calls := newMockJailTracker(t, c.Responses)
+			defer server.Close()
+			jail := &Jail{
+				BaseURL:         server.URL,
+				Name:            "test",
+				OffenderViewKey: 7,
+				solver:          &stubSolver{Text: "a1B2"},
+			}
+			inmate := &Inmate{ArrestNo: "A1"}
+
+			err := inmate.Update(context.Background(), jail)
+			if got := atomic.LoadInt32(calls); got != c.WantCalls {
+				t.Fatalf("unexpected number of inmate requests. Got %d, want %d", got, c.WantCalls)
+			}
+			if c.WantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if got := ClassOf(err); got != c.WantClass {
+					t.Fatalf("unexpected class. Got %s, want %s", got, c.WantClass)
+				}
+				fetch := inmate.Fetch
+				if fetch.Status != FetchFailed || fetch.Attempts != 1 || fetch.LastError == "" ||
+					fetch.LastErrorClass != c.WantClass.String() || fetch.FetchedAtUTC != nil {
+					t.Fatalf("unexpected fetch record for failure: %+v", fetch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fetch := inmate.Fetch; fetch.Status != FetchOK || fetch.Attempts != 1 || fetch.LastError != "" || fetch.FetchedAtUTC == nil {
+				t.Fatalf("unexpected fetch record for success: %+v", fetch)
+			}
+			if len(inmate.Charges) != 1 || jail.OffenderViewKey != 8 {
+				t.Fatalf("inmate not updated. Charges: %v, view key: %d", inmate.Charges, jail.OffenderViewKey)
+			}
+		})
+	}
+}
+
+func TestCrawlJailStopsWithPartialData(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jtclientweb/captcha/getnewcaptchaclient", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"captchaKey":"KEY","captchaImage":"TEST_IMAGE","userCode":null}`))
+	})
+	mux.HandleFunc("/jtclientweb/Captcha/validatecaptcha", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"captchaMatched":true,"captchaKey":"KEY"}`))
+	})
+	mux.HandleFunc("/jtclientweb/Offender/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"offenders":[{"arrestNo":"A1"},{"arrestNo":"A2"},{"arrestNo":"A3"}],"offenderViewKey":7}`))
+	})
+	mux.HandleFunc("/jtclientweb/Offender/test/", func(w http.ResponseWriter, r *http.Request) {
+		// Interrupted while fetching the first inmate
+		cancel()
+		w.Write([]byte(`{"succes":true,"offenderViewKey":7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jail, err := CrawlJail(ctx, server.URL, "test", &stubSolver{Text: "a1B2"}, nil, 0)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error. Got %v", err)
+	}
+	if jail == nil || !jail.Incomplete {
+		t.Fatalf("expected partial jail marked incomplete. Got %+v", jail)
+	}
+	if len(jail.Inmates) != 3 {
+		t.Fatalf("expected inmate list to be kept. Got %d inmates", len(jail.Inmates))
+	}
+}
+
+func TestResumeJail(t *testing.T) {
+	var fetched []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jtclientweb/Offender/test/", func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.Path)
+		w.Write([]byte(`{"succes":true,"offenderViewKey":7}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jail := &Jail{
+		BaseURL:         server.URL,
+		Name:            "test",
+		CaptchaKey:      "SAVED_KEY",
+		OffenderViewKey: 7,
+		Incomplete:      true,
+		Inmates: []Inmate{
+			{ArrestNo: "A1", Fetch: InmateFetch{Status: FetchOK}},
+			{ArrestNo: "A2"},
+			{ArrestNo: "A3"},
+		},
+	}
+	checkpoints := 0
+	checkpoint := func(j *Jail) error {
+		checkpoints++
+		return nil
+	}
+	err := ResumeJail(context.Background(), jail, &stubSolver{Text: "a1B2"}, checkpoint, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"/jtclientweb/Offender/test/A2/offenderbucket/7", "/jtclientweb/Offender/test/A3/offenderbucket/7"}
+	if len(fetched) != len(want) || fetched[0] != want[0] || fetched[1] != want[1] {
+		t.Fatalf("unexpected inmates fetched. Got %v, want %v", fetched, want)
+	}
+	if jail.Incomplete {
+		t.Fatal("expected finished crawl to be marked complete")
+	}
+	for _, inmate := range jail.Inmates {
+		if !inmate.DetailFetched() {
+			t.Fatalf("inmate %s not marked fetched", inmate.ArrestNo)
+		}
+	}
+	// Saved before the second inmate of the resumed crawl, not before the first
+	if checkpoints != 1 {
+		t.Fatalf("unexpected number of checkpoints. Got %d, want 1", checkpoints)
+	}
+}
+
+func TestInmateFetchRecordsRetryAfterFailure(t *testing.T) {
+	server, _ := newMockJailTracker(t, []InmateResponse{{ErrorMessage: "Offender not found"}, {Success: true}})
+	defer server.Close()
+	jail := &Jail{BaseURL: server.URL, Name: "test", OffenderViewKey: 7, solver: &stubSolver{Text: "a1B2"}}
+	inmate := &Inmate{ArrestNo: "A1"}
+	if err := inmate.Update(context.Background(), jail); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err := inmate.Update(context.Background(), jail); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inmate.Fetch.Attempts != 2 || inmate.Fetch.LastError != "" || !inmate.DetailFetched() {
+		t.Fatalf("unexpected fetch record: %+v", inmate.Fetch)
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"time"
 )
 
@@ -26,65 +27,166 @@ type JailResponse struct {
 // Jail is a top-level struct for a task to retrieve the list of inmates in a jail.
 // This is also the type used to serialize to JSON for storage.
 type Jail struct {
+	// Version of the snapshot format; see SnapshotVersion. Older snapshots are upgraded as they're read.
+	SchemaVersion int
 	// BaseURL for the jail. Usually "https://omsweb.public-safety-cloud.com", but not always!
 	BaseURL string
 	// Name of the jail, as it appears in the URL
 	Name string
 	// This is sent with each request, and sometimes updated
 	CaptchaKey string
-	//TODO rename "offenders" to something more appropriate; this is JailTracker terminology
-	Offenders []Inmate
+	// JailTracker calls these "offenders". Saved as "Offenders" before snapshot version 2.
+	Inmates []Inmate
 	// Each request (after validation) updates this key!
 	OffenderViewKey int
 	// When the job started
 	StartTimeUTC time.Time
 	// When the job ended
 	EndTimeUTC time.Time
+	// Captchas solved during the crawl, and their cost
+	CaptchaStats CaptchaStats
+	// IANA time zone of the facility, like "America/Chicago", which inmates' Times were parsed in.
+	// Empty if they weren't; see ParseTimes.
+	TimeZone string
+	// Set while the crawl is in progress, and left set if it was cut short (by Ctrl-C, the jail's deadline, a crash),
+	// so that a later run the same day knows to resume it. See ResumeJail.
+	Incomplete bool
+
+	// Solves captchas for this jail. Not serialized.
+	solver CaptchaSolver
+	// Prefixes log output with the jail's name, since jails are crawled in parallel
+	logger *log.Logger
+	// Set if the jail was loaded, complete, from the cache rather than crawled. Not serialized.
+	cached bool
+	// SchemaVersion of the snapshot the jail was read from, before it was upgraded. Not serialized.
+	readVersion int
+	// Saves progress while updating inmates, every checkpointEvery inmates. Not serialized.
+	checkpoint      func(*Jail) error
+	checkpointEvery int
+}
+
+// jailLogger returns a logger that prefixes messages with the jail's name.
+func jailLogger(name string) *log.Logger {
+	return log.New(log.Writer(), fmt.Sprintf("[%s] ", name), log.Flags()|log.Lmsgprefix)
+}
+
+// logf logs a message prefixed with the jail's name.
+func (j *Jail) logf(format string, v ...any) {
+	if j.logger == nil {
+		j.logger = jailLogger(j.Name)
+	}
+	j.logger.Printf(format, v...)
 }
 
-func NewJail(baseURL, name string) (*Jail, error) {
+func NewJail(ctx context.Context, baseURL, name string, solver CaptchaSolver) (*Jail, error) {
 	j := &Jail{
-		BaseURL:      baseURL,
-		Name:         name,
-		StartTimeUTC: time.Now().UTC(),
+		SchemaVersion: SnapshotVersion,
+		BaseURL:       baseURL,
+		Name:          name,
+		StartTimeUTC:  time.Now().UTC(),
+		solver:        solver,
+		logger:        jailLogger(name),
 	}
-	if err := j.updateCaptcha(); err != nil {
+	if err := j.updateCaptcha(ctx); err != nil {
 		return nil, fmt.Errorf("failed to update captcha: %w", err)
 	}
-	log.Println("Captcha matched!")
 
-	// Make initial request for jail data
+	// Make initial request for jail data.
+	// If JailTracker wants another captcha already, solve one and try once more.
+	var jailResponse *JailResponse
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		jailResponse, err = j.requestOffenders(ctx)
+		if ClassOf(err) != ErrorCaptchaRequired || attempt > 0 {
+			break
+		}
+		j.logf("Captcha required for jail; refreshing")
+		if err := j.updateCaptcha(ctx); err != nil {
+			return nil, fmt.Errorf("failed to update captcha: %w", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j.OffenderViewKey = jailResponse.OffenderViewKey
+	j.Inmates = jailResponse.Offenders
+	for i := range j.Inmates {
+		j.Inmates[i].Fetch = InmateFetch{Status: FetchPending}
+	}
+	return j, nil
+}
+
+// FetchCounts counts inmates by the status of their detail fetch.
+// Pending includes inmates from snapshots taken before fetches were tracked.
+func (j *Jail) FetchCounts() (fetched, failed, pending int) {
+	for i := range j.Inmates {
+		switch j.Inmates[i].Fetch.Status {
+		case FetchOK:
+			fetched++
+		case FetchFailed:
+			failed++
+		default:
+			pending++
+		}
+	}
+	return fetched, failed, pending
+}
+
+// failedFetches returns the number of inmates whose details couldn't be fetched.
+func (j *Jail) failedFetches() int {
+	_, failed, _ := j.FetchCounts()
+	return failed
+}
+
+// requestOffenders requests the list of inmates, retrying JailTracker's transient errors.
+func (j *Jail) requestOffenders(ctx context.Context) (*JailResponse, error) {
 	payload := &CaptchaProtocol{
 		CaptchaKey:   j.CaptchaKey,
 		CaptchaImage: "",
 		// This is normally null in this request in the web client :\
 		UserCode: "",
 	}
-	jailResponse := &JailResponse{}
-	err := PostJSON[CaptchaProtocol, JailResponse](j.getJailAPIURL(), nil, payload, jailResponse)
+	var jailResponse *JailResponse
+	// JailTracker reports its own failures in errorMessage, with a 200 status,
+	// so requestJSON can't tell they're worth retrying.
+	err := retryPolicy.Do(ctx, func() error {
+		jailResponse = &JailResponse{}
+		err := PostJSON[CaptchaProtocol, JailResponse](ctx, j.getJailAPIURL(), nil, payload, jailResponse)
+		if err != nil {
+			return fmt.Errorf("failed to request initial jail data: %w", err)
+		}
+		if jailResponse.ErrorMessage != "" {
+			return jailTrackerError(fmt.Sprintf(`jail "%s"`, j.Name), jailResponse.ErrorMessage)
+		}
+		if jailResponse.CaptchaRequired {
+			return &RequestError{Class: ErrorCaptchaRequired, Err: errors.New("captcha required for jail")}
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to request initial jail data: %w", err)
-	}
-	if jailResponse.ErrorMessage != "" {
-		return nil, fmt.Errorf(`non-empty error message for jail "%s": "%s"`, name, jailResponse.ErrorMessage)
-	}
-	if jailResponse.CaptchaRequired {
-		return nil, fmt.Errorf("captcha required for jail. Response: %v", jailResponse)
+		return nil, err
 	}
-
-	j.OffenderViewKey = jailResponse.OffenderViewKey
-	j.Offenders = jailResponse.Offenders
-	return j, nil
+	return jailResponse, nil
 }
 
-func (j *Jail) updateCaptcha() error {
+func (j *Jail) updateCaptcha(ctx context.Context) error {
 	captchaMatched := false
 	var captchaKey string
 	var err error
 	for i := 0; i < MaxCaptchaAttempts; i++ {
-		captchaKey, err = ProcessCaptcha(j)
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped solving captchas: %w", ctx.Err())
+		}
+		captchaKey, err = ProcessCaptcha(ctx, j)
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) && !errors.Is(err, errSolverFailed) {
+			// JailTracker's captcha service itself failed, and requestJSON has already retried if it was worth it.
+			// Another captcha won't help.
+			return fmt.Errorf("captcha service failed: %w", err)
+		}
 		if err != nil {
-			log.Printf("failed to solve captcha: %v", err)
+			j.logf("failed to solve captcha: %v", err)
 			continue
 		}
 		captchaMatched = true
@@ -94,27 +196,43 @@ func (j *Jail) updateCaptcha() error {
 		return fmt.Errorf("failed to match captcha after %d attempts", MaxCaptchaAttempts)
 	}
 	j.CaptchaKey = captchaKey
-	log.Println("Captcha matched!")
+	j.logf("Captcha matched!")
 
 	return nil
 }
 
-// UpdateInmates updates all inmates in the jail.
-// Currently returns only a nil error, but reserving one here for future use.
-func (j *Jail) UpdateInmates() error {
-	for i := range j.Offenders {
-		// Chill out for a bit to be especially gentle to their server
-		// Convert time.Second (duration in nanoseconds) to float, scale to 0.5-1.5 seconds
-		duration := time.Duration((0.5 + rand.Float64()) * float64(time.Second))
-		time.Sleep(duration)
-
-		inmate := &j.Offenders[i]
-		err := inmate.Update(j)
+// UpdateInmates updates the inmates in the jail whose details haven't been fetched yet.
+// Failures for individual inmates are logged and skipped.
+// An error is returned only if ctx is done before every inmate has been tried.
+func (j *Jail) UpdateInmates(ctx context.Context) error {
+	updated := 0
+	for i := range j.Inmates {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped after %d of %d inmates: %w", i, len(j.Inmates), ctx.Err())
+		}
+		inmate := &j.Inmates[i]
+		if inmate.DetailFetched() { // Done before the crawl was resumed
+			continue
+		}
+		if j.checkpoint != nil && updated > 0 && updated%j.checkpointEvery == 0 {
+			if err := j.checkpoint(j); err != nil {
+				j.logf("failed to save checkpoint: %v", err)
+			}
+		}
+		updated++
+		// No need to sleep between inmates to be gentle to their server:
+		// every request waits its turn with the host's RateLimiter.
+		err := inmate.Update(ctx, j)
+		if ClassOf(err) == ErrorRateLimited {
+			// Still rate limited after backing off. The remaining inmates would only make it worse.
+			j.logf("Rate limited by JailTracker; skipping the remaining %d inmates: %v", len(j.Inmates)-i, err)
+			break
+		}
 		if err != nil {
-			log.Printf("failed to update inmate \"%s\": %v", inmate.ArrestNo, err)
+			j.logf("failed to update inmate \"%s\" (%s error): %v", inmate.ArrestNo, ClassOf(err), err)
 			continue
 		}
-		log.Printf("Updated inmate \"%s\". Cases: %d Charges: %d Holds: %d Booked: %s",
+		j.logf("Updated inmate \"%s\". Cases: %d Charges: %d Holds: %d Booked: %s",
 			inmate.ArrestNo, len(inmate.Cases), len(inmate.Charges), len(inmate.Holds), inmate.OriginalBookDateTime,
 		)
 	}
@@ -133,17 +251,46 @@ func (j Jail) getJailAPIURL() string {
 	return fmt.Sprintf("%s/jtclientweb/Offender/%s", j.BaseURL, j.Name)
 }
 
-func CrawlJail(baseURL, name string) (*Jail, error) {
-	j, err := NewJail(baseURL, name)
+// CrawlJail fetches the list of inmates in a jail, then each inmate's details.
+// Progress is passed to checkpoint, if not nil, every checkpointEvery inmates.
+// If ctx is done partway through the inmates, the partial jail is returned, marked Incomplete,
+// along with the error, so that it can still be saved.
+func CrawlJail(ctx context.Context, baseURL, name string, solver CaptchaSolver, checkpoint func(*Jail) error, checkpointEvery int) (*Jail, error) {
+	j, err := NewJail(ctx, baseURL, name, solver)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize jail: %w", err)
 	}
-	log.Printf("Found %d inmates", len(j.Offenders))
+	j.logf("Found %d inmates", len(j.Inmates))
+	j.checkpoint, j.checkpointEvery = checkpoint, max(checkpointEvery, 1)
+	return j, j.finishCrawl(ctx)
+}
 
-	err = j.UpdateInmates()
+// ResumeJail continues a crawl that was cut short, from a jail saved with Incomplete set.
+// Only inmates whose details are missing are requested.
+// The saved captcha key and view key are reused; if JailTracker has expired the captcha, a new one is solved.
+func ResumeJail(ctx context.Context, j *Jail, solver CaptchaSolver, checkpoint func(*Jail) error, checkpointEvery int) error {
+	j.solver = solver
+	j.checkpoint, j.checkpointEvery = checkpoint, max(checkpointEvery, 1)
+	fetched, _, _ := j.FetchCounts()
+	j.logf("Resuming crawl: %d of %d inmates left", len(j.Inmates)-fetched, len(j.Inmates))
+	return j.finishCrawl(ctx)
+}
+
+// finishCrawl updates the jail's remaining inmates, leaving it marked Incomplete if ctx is done first.
+func (j *Jail) finishCrawl(ctx context.Context) error {
+	j.Incomplete = true
+	err := j.UpdateInmates(ctx)
+	j.EndTimeUTC = time.Now().UTC()
 	if err != nil {
-		return nil, fmt.Errorf("failed to update inmates: %w", err)
+		return fmt.Errorf("failed to update inmates: %w", err)
 	}
-	j.EndTimeUTC = time.Now().UTC()
-	return j, nil
+	j.Incomplete = false
+	fetched, failed, _ := j.FetchCounts()
+	j.logf("Inmate details: %d fetched, %d failed", fetched, failed)
+	stats := j.CaptchaStats
+	j.logf("Captchas: %d fetched, %d accepted, %d rejected by format, %d rejected by server, %d solver errors. "+
+		"Tokens: %d prompt, %d completion. Estimated cost: $%.4f",
+		stats.Fetched, stats.Accepted, stats.RejectedFormat, stats.RejectedServer, stats.SolverErrors,
+		stats.PromptTokens, stats.CompletionTokens, stats.EstimatedCostUSD)
+	return nil
 }
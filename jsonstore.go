@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Matches snapshot file names, capturing the jail name, day, and extension
+var snapshotNamePattern = regexp.MustCompile(`^(.+)-(\d{4}-\d{2}-\d{2})(\.json(?:\.gz|\.zst)?)$`)
+
+// Corrupt snapshots are moved here, under the cache directory, so they can be inspected later
+const quarantineDirName = "quarantine"
+
+// errCorruptSnapshot is wrapped by errors reading snapshots that are truncated or otherwise invalid.
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+// JSONStore keeps snapshots as one JSON file per jail per UTC day, named for the day the crawl started,
+// like "Marion_County_Ms-2024-07-16.json". Resuming a crawl, or checkpointing one that runs past midnight,
+// writes to the same file, and a second crawl on the same day replaces the first.
+// Files are compressed as Compression says, and read in any format.
+type JSONStore struct {
+	Dir         string
+	Compression string
+}
+
+func (s *JSONStore) String() string {
+	return s.Dir
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// Latest returns the jail's snapshot from the latest day.
+func (s *JSONStore) Latest(jailName string) (*Jail, string, error) {
+	pattern := path.Join(s.Dir, jailName+"-[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9].json*")
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var filenames []string
+	for _, filename := range matches {
+		if _, _, _, ok := parseSnapshotName(filename); ok {
+			filenames = append(filenames, filename)
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, "", fmt.Errorf("no snapshots of \"%s\" in %s: %w", jailName, s.Dir, os.ErrNotExist)
+	}
+	// Names end in dates, then extensions, so they sort by time
+	sort.Strings(filenames)
+	filename := filenames[len(filenames)-1]
+	jail, err := readCachedJail(filename)
+	return jail, filename, err
+}
+
+// ForDay returns the jail's snapshot for the given UTC day, in whichever format it was saved.
+func (s *JSONStore) ForDay(jailName string, day time.Time) (*Jail, string, error) {
+	for _, format := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		filename := s.pathFor(jailName, day, format)
+		jail, err := readCachedJail(filename)
+		if !errors.Is(err, os.ErrNotExist) {
+			return jail, filename, err
+		}
+	}
+	return nil, "", fmt.Errorf("no snapshot of \"%s\" for %s in %s: %w", jailName, day.UTC().Format(cacheDateFormat), s.Dir, os.ErrNotExist)
+}
+
+// Save writes the snapshot in the current version, under the UTC day its crawl started, compressed as configured.
+func (s *JSONStore) Save(jail *Jail) error {
+	jail.SchemaVersion = SnapshotVersion
+	data, err := json.MarshalIndent(jail, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal jail data: %w", err)
+	}
+	filename := s.Where(jail)
+	jail.logf("Caching jail data as \"%s\"", filename)
+	return writeSnapshot(filename, data, s.format())
+}
+
+// Where returns the path to the jail's cache file.
+// A jail that hasn't started crawling yet goes under the current UTC day.
+func (s *JSONStore) Where(jail *Jail) string {
+	start := jail.StartTimeUTC
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return s.pathFor(jail.Name, start, s.format())
+}
+
+// Quarantine moves a corrupt snapshot out of the way, returning its new path.
+// The new name is stamped with the time, so quarantining the same day's file twice keeps both.
+func (s *JSONStore) Quarantine(filename string) (string, error) {
+	dir := path.Join(s.Dir, quarantineDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	quarantined := path.Join(dir, fmt.Sprintf("%s.%s", path.Base(filename), time.Now().UTC().Format("20060102T150405.000000000Z")))
+	if err := os.Rename(filename, quarantined); err != nil {
+		return "", fmt.Errorf("failed to quarantine snapshot: %w", err)
+	}
+	return quarantined, nil
+}
+
+func (s *JSONStore) format() string {
+	format, err := parseCompression(s.Compression)
+	if err != nil {
+		return CompressionNone
+	}
+	return format
+}
+
+// pathFor returns the path to the jail's cache file for the given UTC day and format.
+func (s *JSONStore) pathFor(jailName string, day time.Time, format string) string {
+	filename := fmt.Sprintf("%s-%s%s", jailName, day.UTC().Format(cacheDateFormat), compressionExts[format])
+	return path.Join(s.Dir, filename)
+}
+
+// parseSnapshotName splits the path of a snapshot into the jail name, UTC day and extension.
+func parseSnapshotName(filename string) (jailName, day, ext string, ok bool) {
+	m := snapshotNamePattern.FindStringSubmatch(path.Base(filename))
+	if m == nil {
+		return "", "", "", false
+	}
+	return m[1], m[2], m[3], true
+}
+
+// readCachedJail reads a jail snapshot file.
+// If it's truncated or invalid, the error wraps errCorruptSnapshot.
+func readCachedJail(filename string) (*Jail, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSnapshot(filename, data)
+}
+
+// decodeSnapshot decompresses, upgrades, unmarshals and validates a snapshot read from filename.
+func decodeSnapshot(filename string, data []byte) (*Jail, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	data, version, err := upgradeSnapshot(data)
+	if errors.Is(err, errNewerSnapshot) {
+		return nil, fmt.Errorf("\"%s\": %w", filename, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	jail := &Jail{readVersion: version}
+	err = json.Unmarshal(data, jail)
+	if err != nil {
+		return nil, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	if err := validateSnapshot(jail); err != nil {
+		return nil, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	return jail, nil
+}
+
+// validateSnapshot checks that a jail read from the cache is a real snapshot.
+// An empty object, or "null", is valid JSON but not a crawl.
+func validateSnapshot(jail *Jail) error {
+	if jail.Name == "" {
+		return errors.New("no jail name")
+	}
+	if jail.StartTimeUTC.IsZero() {
+		return errors.New("no crawl start time")
+	}
+	return nil
+}
+
+// writeSnapshot compresses snapshot JSON and writes it atomically to filename,
+// which should have the format's extension.
+// Copies of the same snapshot in other formats are then removed, so each day has just one.
+func writeSnapshot(filename string, data []byte, format string) error {
+	data, err := compress(data, format)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filename, data, 0644); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(filename, compressionExts[format])
+	for otherFormat, ext := range compressionExts {
+		if otherFormat == format {
+			continue
+		}
+		if err := os.Remove(base + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove old copy of snapshot: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestJSONStoreLatest(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+
+	if _, _, err := store.Latest("a"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist with no snapshots. Got %v", err)
+	}
+	day := time.Date(2024, 7, 16, 23, 30, 0, 0, time.UTC)
+	for _, jail := range []*Jail{
+		{Name: "a", StartTimeUTC: day.Add(-48 * time.Hour)},
+		{Name: "a", StartTimeUTC: day},
+		// Shares a prefix with "a", and is newer, but isn't a snapshot of "a"
+		{Name: "a-b", StartTimeUTC: day.Add(48 * time.Hour)},
+	} {
+		if err := store.Save(jail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jail, filename, err := store.Latest("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(store.Dir, "a-2024-07-16.json"); filename != want {
+		t.Fatalf("unexpected snapshot. Got %s, want %s", filename, want)
+	}
+	if !jail.StartTimeUTC.Equal(day) {
+		t.Fatalf("unexpected start time: %v", jail.StartTimeUTC)
+	}
+}
+
+func TestJSONStoreWhereUsesCrawlStart(t *testing.T) {
+	store := &JSONStore{Dir: "cache"}
+	// A crawl started just before midnight UTC keeps its file when it checkpoints after midnight,
+	// whatever the local time zone.
+	start := time.Date(2024, 7, 16, 23, 59, 0, 0, time.UTC)
+	got := store.Where(&Jail{Name: "a", StartTimeUTC: start})
+	if want := path.Join(store.Dir, "a-2024-07-16.json"); got != want {
+		t.Fatalf("unexpected path. Got %s, want %s", got, want)
+	}
+	local := start.In(time.FixedZone("UTC+2", 2*60*60))
+	if got := store.Where(&Jail{Name: "a", StartTimeUTC: local}); got != path.Join(store.Dir, "a-2024-07-16.json") {
+		t.Fatalf("expected path by UTC day. Got %s", got)
+	}
+}
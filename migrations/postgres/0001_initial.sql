@@ -0,0 +1,101 @@
+-- Crawls, keyed by jail slug and crawl start time. Everything else hangs off a crawl,
+-- keyed by position in JailTracker's order, and is replaced along with it.
+CREATE TABLE jtt.crawls (
+	id BIGSERIAL PRIMARY KEY,
+	jail TEXT NOT NULL,
+	start_time_utc TIMESTAMPTZ NOT NULL,
+	-- UTC day of start_time_utc
+	day DATE NOT NULL,
+	end_time_utc TIMESTAMPTZ,
+	base_url TEXT NOT NULL,
+	incomplete BOOLEAN NOT NULL,
+	captchas_fetched INTEGER NOT NULL,
+	captchas_solved INTEGER NOT NULL,
+	captcha_solver_errors INTEGER NOT NULL,
+	captchas_rejected_format INTEGER NOT NULL,
+	captchas_rejected_server INTEGER NOT NULL,
+	captchas_accepted INTEGER NOT NULL,
+	prompt_tokens INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	estimated_cost_usd DOUBLE PRECISION NOT NULL,
+	-- SHA-256 of the snapshot's JSON when it was pushed, so unchanged snapshots aren't pushed again
+	snapshot_sha256 TEXT NOT NULL,
+	synced_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (jail, start_time_utc)
+);
+CREATE INDEX crawls_by_day ON jtt.crawls (jail, day);
+
+CREATE TABLE jtt.inmates (
+	crawl_id BIGINT NOT NULL REFERENCES jtt.crawls (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	arrest_no TEXT NOT NULL,
+	original_book_date_time TEXT NOT NULL,
+	final_release_date_time TEXT NOT NULL,
+	agency_name TEXT NOT NULL,
+	jacket TEXT NOT NULL,
+	fetch_status TEXT NOT NULL,
+	fetch_attempts INTEGER NOT NULL,
+	fetch_last_error TEXT NOT NULL,
+	fetch_last_error_class TEXT NOT NULL,
+	fetched_at_utc TIMESTAMPTZ,
+	PRIMARY KEY (crawl_id, position)
+);
+CREATE INDEX inmates_by_arrest_no ON jtt.inmates (arrest_no);
+
+CREATE TABLE jtt.cases (
+	crawl_id BIGINT NOT NULL,
+	inmate_position INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	case_no TEXT NOT NULL,
+	status TEXT NOT NULL,
+	bond_type TEXT NOT NULL,
+	bond_amount DOUBLE PRECISION NOT NULL,
+	fine_amount DOUBLE PRECISION NOT NULL,
+	sentence TEXT NOT NULL,
+	court_time TEXT NOT NULL,
+	PRIMARY KEY (crawl_id, inmate_position, position),
+	FOREIGN KEY (crawl_id, inmate_position) REFERENCES jtt.inmates (crawl_id, position) ON DELETE CASCADE
+);
+
+CREATE TABLE jtt.charges (
+	crawl_id BIGINT NOT NULL,
+	inmate_position INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	"case" TEXT NOT NULL,
+	case_no TEXT NOT NULL,
+	crime_type TEXT NOT NULL,
+	control_number TEXT NOT NULL,
+	warrant_number TEXT NOT NULL,
+	arrest_code TEXT NOT NULL,
+	charge_description TEXT NOT NULL,
+	bond_type TEXT NOT NULL,
+	bond_amount TEXT NOT NULL,
+	court_type TEXT NOT NULL,
+	court_time TEXT NOT NULL,
+	court_name TEXT NOT NULL,
+	charge_status TEXT NOT NULL,
+	offense_date TEXT NOT NULL,
+	arrest_date TEXT NOT NULL,
+	arresting_agency TEXT NOT NULL,
+	PRIMARY KEY (crawl_id, inmate_position, position),
+	FOREIGN KEY (crawl_id, inmate_position) REFERENCES jtt.inmates (crawl_id, position) ON DELETE CASCADE
+);
+
+CREATE TABLE jtt.holds (
+	crawl_id BIGINT NOT NULL,
+	inmate_position INTEGER NOT NULL,
+	position INTEGER NOT NULL,
+	data JSONB NOT NULL,
+	PRIMARY KEY (crawl_id, inmate_position, position),
+	FOREIGN KEY (crawl_id, inmate_position) REFERENCES jtt.inmates (crawl_id, position) ON DELETE CASCADE
+);
+
+-- Labelled as JailTracker labels them, like "Booking Date:". Empty fields are left out.
+CREATE TABLE jtt.special_fields (
+	crawl_id BIGINT NOT NULL,
+	inmate_position INTEGER NOT NULL,
+	label TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (crawl_id, inmate_position, label),
+	FOREIGN KEY (crawl_id, inmate_position) REFERENCES jtt.inmates (crawl_id, position) ON DELETE CASCADE
+);
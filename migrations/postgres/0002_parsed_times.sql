@@ -0,0 +1,9 @@
+-- Timestamps parsed in the facility's time zone, next to the raw text. NULL if unparsed.
+ALTER TABLE jtt.crawls ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE jtt.inmates ADD COLUMN original_book_date_time_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.inmates ADD COLUMN final_release_date_time_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.cases ADD COLUMN court_time_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.charges ADD COLUMN court_time_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.charges ADD COLUMN offense_date_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.charges ADD COLUMN arrest_date_parsed TIMESTAMPTZ;
+ALTER TABLE jtt.special_fields ADD COLUMN value_parsed TIMESTAMPTZ;
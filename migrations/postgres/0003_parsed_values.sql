@@ -0,0 +1,8 @@
+-- Amounts in exact cents and sentences in years, months and days, next to the raw values. NULL if unparsed.
+ALTER TABLE jtt.cases ADD COLUMN bond_cents BIGINT;
+ALTER TABLE jtt.cases ADD COLUMN fine_cents BIGINT;
+ALTER TABLE jtt.cases ADD COLUMN sentence_years INTEGER;
+ALTER TABLE jtt.cases ADD COLUMN sentence_months INTEGER;
+ALTER TABLE jtt.cases ADD COLUMN sentence_days INTEGER;
+ALTER TABLE jtt.cases ADD COLUMN sentence_total_days INTEGER;
+ALTER TABLE jtt.charges ADD COLUMN bond_cents BIGINT;
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"os"
+	"strings"
+)
+
+// The template model shipped with JTT. See LoadOCRModel.
+//
+//go:embed ocr_model.json
+var defaultOCRModel []byte
+
+const (
+	// Glyphs are scaled into a grid of this size before comparison
+	ocrGridWidth  = 12
+	ocrGridHeight = 16
+	// Connected blobs of ink smaller than this are treated as noise
+	ocrMinComponentSize = 4
+	// So far, every captcha has been 4 characters. See solutionPattern.
+	captchaLength = 4
+)
+
+// OCRTemplate is a labelled glyph bitmap.
+type OCRTemplate struct {
+	Label string
+	// Glyph cropped to its ink, one string per row. '#' is ink, anything else is background.
+	Rows []string
+
+	// Rows, normalized to the comparison grid
+	grid []bool
+}
+
+// OCRModel is a nearest-neighbour classifier over glyph templates.
+type OCRModel struct {
+	// Free-form notes on where the templates came from
+	Description string
+	Templates   []OCRTemplate
+}
+
+// LoadOCRModel reads a model from a JSON file. An empty path loads the model shipped with JTT.
+func LoadOCRModel(path string) (*OCRModel, error) {
+	if path == "" {
+		return ParseOCRModel(defaultOCRModel)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCR model: %w", err)
+	}
+	return ParseOCRModel(data)
+}
+
+// ParseOCRModel unmarshals a model and prepares its templates for classification.
+func ParseOCRModel(data []byte) (*OCRModel, error) {
+	model := &OCRModel{}
+	err := json.Unmarshal(data, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OCR model: %w", err)
+	}
+	if len(model.Templates) == 0 {
+		return nil, errors.New("OCR model has no templates")
+	}
+	for i := range model.Templates {
+		template := &model.Templates[i]
+		glyph := bitmapFromRows(template.Rows)
+		if glyph.inkCount() == 0 {
+			return nil, fmt.Errorf(`template %d ("%s") has no ink`, i, template.Label)
+		}
+		template.grid = glyph.normalize()
+	}
+	return model, nil
+}
+
+// classify returns the label of the nearest template, and a confidence based on how far
+// ahead of the nearest template with a different label it is.
+func (m *OCRModel) classify(grid []bool) (string, float64) {
+	bestLabel := ""
+	best, runnerUp := len(grid)+1, len(grid)+1
+	for _, template := range m.Templates {
+		d := hammingDistance(grid, template.grid)
+		if d < best {
+			if template.Label != bestLabel {
+				runnerUp = best
+			}
+			best, bestLabel = d, template.Label
+		} else if d < runnerUp && template.Label != bestLabel {
+			runnerUp = d
+		}
+	}
+	if runnerUp == 0 {
+		return bestLabel, 0
+	}
+	return bestLabel, float64(runnerUp-best) / float64(runnerUp)
+}
+
+// LocalSolver reads captchas offline with an OCRModel. No network or API key is needed.
+type LocalSolver struct {
+	Model *OCRModel
+}
+
+// NewLocalSolver loads the model at modelPath, or the shipped model if modelPath is empty.
+func NewLocalSolver(modelPath string) (*LocalSolver, error) {
+	model, err := LoadOCRModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalSolver{Model: model}, nil
+}
+
+// Solve decodes the image, separates it into glyphs, and classifies each glyph.
+// Confidence is that of the least certain glyph.
+func (s *LocalSolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	img, err := decodeInlineImage(inlineImage)
+	if err != nil {
+		return nil, err
+	}
+	page := binarize(img)
+	page.denoise(ocrMinComponentSize)
+	glyphs, err := page.segment(captchaLength)
+	if err != nil {
+		return nil, err
+	}
+	var text strings.Builder
+	confidence := 1.0
+	for _, glyph := range glyphs {
+		label, c := s.Model.classify(glyph.normalize())
+		text.WriteString(label)
+		confidence = min(confidence, c)
+	}
+	return &CaptchaGuess{
+		Text:       text.String(),
+		Confidence: confidence,
+		Solver:     "local",
+	}, nil
+}
+
+// decodeInlineImage decodes a data URL such as "data:image/gif;base64,R0lGOD...".
+func decodeInlineImage(inlineImage string) (image.Image, error) {
+	data, err := decodeInlineImageBytes(inlineImage)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode captcha image: %w", err)
+	}
+	return img, nil
+}
+
+// decodeInlineImageBytes returns the raw image file from a base64 data URL.
+func decodeInlineImageBytes(inlineImage string) ([]byte, error) {
+	_, encoded, found := strings.Cut(inlineImage, ";base64,")
+	if !found {
+		return nil, errors.New("captcha image is not a base64 data URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode captcha image base64: %w", err)
+	}
+	return data, nil
+}
+
+// bitmap is a binary image. True pixels are ink.
+type bitmap struct {
+	w, h int
+	ink  []bool
+}
+
+func newBitmap(w, h int) *bitmap {
+	return &bitmap{w: w, h: h, ink: make([]bool, w*h)}
+}
+
+func bitmapFromRows(rows []string) *bitmap {
+	w := 0
+	for _, row := range rows {
+		w = max(w, len(row))
+	}
+	b := newBitmap(w, len(rows))
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			b.set(x, y, row[x] == '#')
+		}
+	}
+	return b
+}
+
+func (b *bitmap) at(x, y int) bool {
+	return b.ink[y*b.w+x]
+}
+
+func (b *bitmap) set(x, y int, ink bool) {
+	b.ink[y*b.w+x] = ink
+}
+
+func (b *bitmap) inkCount() int {
+	n := 0
+	for _, ink := range b.ink {
+		if ink {
+			n++
+		}
+	}
+	return n
+}
+
+// binarize converts an image to ink and background using Otsu's threshold on luminance.
+// Ink is assumed to be the minority of pixels, whichever side of the threshold it's on.
+func binarize(img image.Image) *bitmap {
+	bounds := img.Bounds()
+	b := newBitmap(bounds.Dx(), bounds.Dy())
+	luma := make([]uint8, b.w*b.h)
+	var histogram [256]int
+	for y := 0; y < b.h; y++ {
+		for x := 0; x < b.w; x++ {
+			r, g, bl, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// ITU-R 601 luma, from 16-bit channels to 8-bit
+			l := uint8((299*r + 587*g + 114*bl) / 1000 >> 8)
+			luma[y*b.w+x] = l
+			histogram[l]++
+		}
+	}
+
+	threshold := otsuThreshold(histogram, len(luma))
+	dark := 0
+	for _, l := range luma {
+		if l <= threshold {
+			dark++
+		}
+	}
+	inkIsDark := dark*2 <= len(luma)
+	for i, l := range luma {
+		b.ink[i] = (l <= threshold) == inkIsDark
+	}
+	return b
+}
+
+// otsuThreshold picks the threshold maximizing between-class variance.
+func otsuThreshold(histogram [256]int, total int) uint8 {
+	sum := 0.0
+	for i, n := range histogram {
+		sum += float64(i * n)
+	}
+	var sumBackground, bestVariance float64
+	weightBackground := 0
+	threshold := uint8(0)
+	for i, n := range histogram {
+		weightBackground += n
+		if weightBackground == 0 {
+			continue
+		}
+		weightForeground := total - weightBackground
+		if weightForeground == 0 {
+			break
+		}
+		sumBackground += float64(i * n)
+		meanBackground := sumBackground / float64(weightBackground)
+		meanForeground := (sum - sumBackground) / float64(weightForeground)
+		variance := float64(weightBackground) * float64(weightForeground) *
+			(meanBackground - meanForeground) * (meanBackground - meanForeground)
+		if variance > bestVariance {
+			bestVariance = variance
+			threshold = uint8(i)
+		}
+	}
+	return threshold
+}
+
+// denoise erases connected blobs of ink (8-connectivity) smaller than minSize pixels.
+// This removes the speckle JailTracker sprinkles over its captchas.
+func (b *bitmap) denoise(minSize int) {
+	seen := make([]bool, len(b.ink))
+	var stack, component []int
+	for start := range b.ink {
+		if !b.ink[start] || seen[start] {
+			continue
+		}
+		component = component[:0]
+		stack = append(stack[:0], start)
+		seen[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			component = append(component, i)
+			x, y := i%b.w, i/b.w
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= b.w || ny >= b.h {
+						continue
+					}
+					j := ny*b.w + nx
+					if b.ink[j] && !seen[j] {
+						seen[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+		if len(component) < minSize {
+			for _, i := range component {
+				b.ink[i] = false
+			}
+		}
+	}
+}
+
+// span is a half-open range of columns.
+type span struct {
+	start, end int
+}
+
+// segment splits the bitmap into n glyphs using the vertical projection of ink.
+// Blank columns separate glyphs. If that gives too many pieces, the closest neighbours are merged;
+// if too few, the widest piece is cut at its thinnest column.
+func (b *bitmap) segment(n int) ([]*bitmap, error) {
+	columns := make([]int, b.w)
+	for y := 0; y < b.h; y++ {
+		for x := 0; x < b.w; x++ {
+			if b.at(x, y) {
+				columns[x]++
+			}
+		}
+	}
+
+	var spans []span
+	for x := 0; x < b.w; x++ {
+		if columns[x] == 0 {
+			continue
+		}
+		if len(spans) > 0 && spans[len(spans)-1].end == x {
+			spans[len(spans)-1].end++
+		} else {
+			spans = append(spans, span{x, x + 1})
+		}
+	}
+	if len(spans) == 0 {
+		return nil, errors.New("no ink found in captcha")
+	}
+
+	for len(spans) > n {
+		// Merge across the narrowest gap
+		merge := 0
+		for i := 1; i < len(spans)-1; i++ {
+			if spans[i+1].start-spans[i].end < spans[merge+1].start-spans[merge].end {
+				merge = i
+			}
+		}
+		spans[merge].end = spans[merge+1].end
+		spans = append(spans[:merge+1], spans[merge+2:]...)
+	}
+
+	for len(spans) < n {
+		widest := 0
+		for i := range spans {
+			if spans[i].end-spans[i].start > spans[widest].end-spans[widest].start {
+				widest = i
+			}
+		}
+		s := spans[widest]
+		width := s.end - s.start
+		if width < 2 {
+			return nil, fmt.Errorf("found %d glyphs, want %d", len(spans), n)
+		}
+		// Cut at the thinnest column in the middle half, so we don't shave off an edge
+		cut := s.start + width/2
+		for x := s.start + width/4; x < s.end-width/4; x++ {
+			if columns[x] < columns[cut] {
+				cut = x
+			}
+		}
+		if cut == s.start {
+			cut++
+		}
+		spans = append(spans[:widest+1], spans[widest:]...)
+		spans[widest] = span{s.start, cut}
+		spans[widest+1] = span{cut, s.end}
+	}
+
+	glyphs := make([]*bitmap, len(spans))
+	for i, s := range spans {
+		glyphs[i] = b.cropToInk(s.start, s.end)
+	}
+	return glyphs, nil
+}
+
+// cropToInk returns the columns [x0, x1) of the bitmap, trimmed to the rows containing ink.
+func (b *bitmap) cropToInk(x0, x1 int) *bitmap {
+	y0, y1 := b.h, 0
+	for y := 0; y < b.h; y++ {
+		for x := x0; x < x1; x++ {
+			if b.at(x, y) {
+				y0, y1 = min(y0, y), max(y1, y+1)
+				break
+			}
+		}
+	}
+	if y0 >= y1 {
+		return newBitmap(0, 0)
+	}
+	c := newBitmap(x1-x0, y1-y0)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c.set(x-x0, y-y0, b.at(x, y))
+		}
+	}
+	return c
+}
+
+// normalize scales a glyph into the comparison grid, preserving its aspect ratio
+// so that narrow glyphs like "l" and "1" aren't stretched into blobs.
+func (b *bitmap) normalize() []bool {
+	grid := make([]bool, ocrGridWidth*ocrGridHeight)
+	if b.w == 0 || b.h == 0 {
+		return grid
+	}
+	scale := float64(ocrGridHeight) / float64(b.h)
+	if float64(b.w)*scale > ocrGridWidth {
+		scale = float64(ocrGridWidth) / float64(b.w)
+	}
+	w := max(1, int(float64(b.w)*scale+0.5))
+	h := max(1, int(float64(b.h)*scale+0.5))
+	offsetX := (ocrGridWidth - w) / 2
+	offsetY := (ocrGridHeight - h) / 2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			srcX := min(b.w-1, int(float64(x)/scale))
+			srcY := min(b.h-1, int(float64(y)/scale))
+			grid[(offsetY+y)*ocrGridWidth+offsetX+x] = b.at(srcX, srcY)
+		}
+	}
+	return grid
+}
+
+func hammingDistance(a, b []bool) int {
+	d := 0
+	for i := range a {
+		if a[i] != b[i] {
+			d++
+		}
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// renderCaptcha draws text with the shipped templates, scaled up and speckled with noise,
+// and returns it as an inline GIF the way JailTracker sends it.
+func renderCaptcha(t *testing.T, model *OCRModel, text string, scale int) string {
+	t.Helper()
+	glyphs := make([]*bitmap, len(text))
+	width := 10
+	for i := range text {
+		for _, template := range model.Templates {
+			if template.Label == text[i:i+1] {
+				glyphs[i] = bitmapFromRows(template.Rows)
+				break
+			}
+		}
+		if glyphs[i] == nil {
+			t.Fatalf(`no template for "%c"`, text[i])
+		}
+		width += (glyphs[i].w + 3) * scale
+	}
+
+	palette := color.Palette{color.White, color.Black}
+	height := 13*scale + 6
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	x := 5
+	for _, glyph := range glyphs {
+		for gy := 0; gy < glyph.h*scale; gy++ {
+			for gx := 0; gx < glyph.w*scale; gx++ {
+				if glyph.at(gx/scale, gy/scale) {
+					img.SetColorIndex(x+gx, 3+gy, 1)
+				}
+			}
+		}
+		x += (glyph.w + 3) * scale
+	}
+	// Isolated specks, which denoise should remove
+	for i := 0; i < width; i += 7 {
+		img.SetColorIndex(i, 0, 1)
+		img.SetColorIndex(i, height-1, 1)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("failed to encode GIF: %v", err)
+	}
+	return "data:image/gif;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestLocalSolver(t *testing.T) {
+	solver, err := NewLocalSolver("")
+	if err != nil {
+		t.Fatalf("failed to load shipped model: %v", err)
+	}
+	for _, text := range []string{"a1B2", "XK7p", "0m9Z"} {
+		for _, scale := range []int{1, 3} {
+			guess, err := solver.Solve(context.Background(), renderCaptcha(t, solver.Model, text, scale))
+			if err != nil {
+				t.Fatalf(`unexpected error for "%s" at scale %d: %v`, text, scale, err)
+			}
+			if guess.Text != text {
+				t.Fatalf(`unexpected solution at scale %d. Got "%s", want "%s"`, scale, guess.Text, text)
+			}
+			if !solutionFormatIsValid(guess.Text) {
+				t.Fatalf(`solution "%s" has invalid format`, guess.Text)
+			}
+		}
+	}
+}
+
+func TestLocalSolverBadImage(t *testing.T) {
+	solver, err := NewLocalSolver("")
+	if err != nil {
+		t.Fatalf("failed to load shipped model: %v", err)
+	}
+	invalidCases := []string{
+		"TEST_IMAGE",                          // Not a data URL
+		"data:image/gif;base64,!!!",           // Bad base64
+		"data:image/gif;base64,R0lGODlh",      // Truncated GIF
+		renderCaptcha(t, solver.Model, "", 1), // No ink
+	}
+	for _, c := range invalidCases {
+		if _, err := solver.Solve(context.Background(), c); err == nil {
+			t.Fatalf(`expected error for image "%s", got nil`, c)
+		}
+	}
+}
+
+func TestSegmentSplitsTouchingGlyphs(t *testing.T) {
+	// Two 3-column glyphs joined by a thin stroke, plus two separate ones
+	b := bitmapFromRows([]string{
+		"####### # #",
+		"#.#.#.# # #",
+		"###.### # #",
+	})
+	glyphs, err := b.segment(4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(glyphs) != 4 || glyphs[0].w != 3 || glyphs[1].w != 4 {
+		t.Fatalf("unexpected segmentation: %d glyphs, widths %d and %d", len(glyphs), glyphs[0].w, glyphs[1].w)
+	}
+}
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strings"
 )
 
-var OpenAICompletionsURL = "https://api.openai.com/v1/chat/completions"
+// Defaults for OpenAI solvers. These can be changed for every solver with JTT_OPENAI_BASE_URL, JTT_OPENAI_MODEL,
+// JTT_OPENAI_MAX_TOKENS and JTT_OPENAI_PROMPT, and for a single solver in config.json.
+const (
+	DefaultOpenAIBaseURL   = "https://api.openai.com/v1"
+	DefaultOpenAIModel     = "gpt-4o"
+	DefaultOpenAIMaxTokens = 300
+	DefaultOpenAIPrompt    = "The user will send you images containing a single word of obfuscated text. Reply only with the text in the image, with no spaces or quotes."
+)
+
+// List prices for gpt-4o, in US dollars per million tokens.
+// Used to estimate spend; override per solver in config if your pricing differs.
+const (
+	DefaultOpenAIPromptPrice     = 2.50
+	DefaultOpenAICompletionPrice = 10.00
+)
 
 // RequestPayload represents the entire request payload
 type RequestPayload struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens"`
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float64  `json:"temperature,omitempty"`
 }
 
 // Message represents an individual message in the payload
@@ -59,6 +76,14 @@ type ImageURL struct {
 
 type CompletionResponse struct {
 	Choices []ResponseChoice `json:"choices"`
+	Usage   Usage            `json:"usage"`
+}
+
+// Usage is the token count billed for a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // ResponseChoice represents a Choice in the response, with a simplified Content
@@ -68,17 +93,17 @@ type ResponseChoice struct {
 	} `json:"message"`
 }
 
-// Get the payload to request a captcha solve from GPT-4o
-func getCaptchaPayload(inlineImage string) *RequestPayload {
+// Get the payload to request a captcha solve
+func (s *OpenAISolver) getCaptchaPayload(inlineImage string) *RequestPayload {
 	return &RequestPayload{
-		Model: "gpt-4o",
+		Model: s.Model,
 		Messages: []Message{
 			{
 				Role: "system",
 				Content: []Content{
 					{
 						Type: "text",
-						Text: "The user will send you images containing a single word of obfuscated text. Reply only with the text in the image, with no spaces or quotes.",
+						Text: s.Prompt,
 					},
 				},
 			},
@@ -94,25 +119,79 @@ func getCaptchaPayload(inlineImage string) *RequestPayload {
 				},
 			},
 		},
-		MaxTokens: 300,
+		MaxTokens:   s.MaxTokens,
+		Temperature: s.Temperature,
+	}
+}
+
+// OpenAISolver solves captchas with an OpenAI vision model,
+// or any server implementing the same chat completions API.
+type OpenAISolver struct {
+	// Chat completions endpoint
+	URL    string
+	APIKey string
+	Model  string
+	// System prompt sent with each image
+	Prompt    string
+	MaxTokens int
+	// Left to the server's default if nil
+	Temperature *float64
+	// US dollars per million tokens, for cost estimates
+	PromptPrice     float64
+	CompletionPrice float64
+}
+
+// NewOpenAISolver returns a solver using the default model, prompt and prices
+// with the chat completions endpoint under baseURL.
+func NewOpenAISolver(baseURL, apiKey string) *OpenAISolver {
+	return &OpenAISolver{
+		URL:             strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+		APIKey:          apiKey,
+		Model:           DefaultOpenAIModel,
+		Prompt:          DefaultOpenAIPrompt,
+		MaxTokens:       DefaultOpenAIMaxTokens,
+		PromptPrice:     DefaultOpenAIPromptPrice,
+		CompletionPrice: DefaultOpenAICompletionPrice,
 	}
 }
 
 // Solve a captcha image, returning the pictured text or an error.
-func solveCaptchaOpenAI(inline_image string) (string, error) {
-	payload := getCaptchaPayload(inline_image)
+// The model doesn't tell us how sure it is, so Confidence is always 1.
+func (s *OpenAISolver) Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error) {
+	payload := s.getCaptchaPayload(inlineImage)
 	completion := &CompletionResponse{}
 	headers := map[string][]string{
-		"Authorization": {"Bearer " + appEnv.OpenAIAPIKey},
+		"Authorization": {"Bearer " + s.APIKey},
 	}
-	err := PostJSON[RequestPayload, CompletionResponse](OpenAICompletionsURL, headers, payload, completion)
+	err := PostJSON[RequestPayload, CompletionResponse](ctx, s.URL, headers, payload, completion)
 	if err != nil {
-		return "", fmt.Errorf("error from OpenAI: %w", err)
-
+		return nil, fmt.Errorf("error from OpenAI: %w", err)
 	}
 
 	if len(completion.Choices) == 0 {
-		return "", fmt.Errorf("no choices in OpenAI completion %v", completion)
+		return nil, fmt.Errorf("no choices in OpenAI completion %v", completion)
 	}
-	return completion.Choices[0].Message.Content, nil
+	usage := completion.Usage
+	return &CaptchaGuess{
+		Text:             cleanSolution(completion.Choices[0].Message.Content),
+		Confidence:       1,
+		Solver:           "openai",
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CostUSD: (float64(usage.PromptTokens)*s.PromptPrice +
+			float64(usage.CompletionTokens)*s.CompletionPrice) / 1e6,
+	}, nil
+}
+
+// cleanSolution strips what models tend to add around an answer despite the prompt:
+// surrounding whitespace and quotes, then anything that isn't an ASCII letter or digit.
+// Whatever is left still has to pass solutionFormatIsValid.
+func cleanSolution(text string) string {
+	text = strings.Trim(strings.TrimSpace(text), "\"'`")
+	return strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, text)
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAISolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer TEST_API_KEY" {
+			t.Errorf("unexpected Authorization header. Got %s", got)
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("failed to read request body: %v", err)
+		}
+		payload := &RequestPayload{}
+		if err := json.Unmarshal(data, payload); err != nil {
+			t.Fatalf("failed to unmarshal request body: %v", err)
+		}
+		// Image should be passed through as the user message
+		if len(payload.Messages) != 2 || payload.Messages[1].Content[0].ImageURL.URL != "TEST_IMAGE" {
+			t.Errorf("image not sent as expected: %s", data)
+		}
+		if payload.Model != "test-model" || payload.Messages[0].Content[0].Text != "TEST_PROMPT" ||
+			payload.MaxTokens != 10 || payload.Temperature == nil || *payload.Temperature != 0 {
+			t.Errorf("settings not sent as expected: %s", data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":" \"a1B2.\"\n"}}],"usage":{"prompt_tokens":300,"completion_tokens":3,"total_tokens":303}}`))
+	}))
+	defer ts.Close()
+
+	temperature := 0.0
+	solver := &OpenAISolver{
+		URL:             ts.URL,
+		APIKey:          "TEST_API_KEY",
+		Model:           "test-model",
+		Prompt:          "TEST_PROMPT",
+		MaxTokens:       10,
+		Temperature:     &temperature,
+		PromptPrice:     2,
+		CompletionPrice: 10,
+	}
+	guess, err := solver.Solve(context.Background(), "TEST_IMAGE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guess.Text != "a1B2" {
+		t.Fatalf("unexpected solution. Got %s, want a1B2", guess.Text)
+	}
+	if guess.PromptTokens != 300 || guess.CompletionTokens != 3 {
+		t.Fatalf("unexpected usage. Got %d/%d, want 300/3", guess.PromptTokens, guess.CompletionTokens)
+	}
+	// 300 * $2/M + 3 * $10/M
+	if guess.CostUSD < 0.000629 || guess.CostUSD > 0.000631 {
+		t.Fatalf("unexpected cost. Got %f, want 0.00063", guess.CostUSD)
+	}
+}
+
+func TestOpenAISolverNoChoices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer ts.Close()
+
+	solver := &OpenAISolver{URL: ts.URL}
+	if _, err := solver.Solve(context.Background(), "TEST_IMAGE"); err == nil {
+		t.Fatal("expected error for empty choices, got nil")
+	}
+}
+
+func TestCleanSolution(t *testing.T) {
+	cases := map[string]string{
+		"a1B2":       "a1B2",
+		" a1B2\n":    "a1B2",
+		`"a1B2"`:     "a1B2",
+		"'a1B2'.":    "a1B2",
+		"`a1 B2`":    "a1B2",
+		"a-1_B2!":    "a1B2",
+		"BVλd":       "BVd",
+		"It's: a1B2": "Itsa1B2", // Still rejected by the format check
+	}
+	for raw, want := range cases {
+		if got := cleanSolution(raw); got != want {
+			t.Fatalf(`unexpected cleaned solution for "%s". Got "%s", want "%s"`, raw, got, want)
+		}
+	}
+}
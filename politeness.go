@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateLimit is a politeness policy for requests to a JailTracker host.
+type RateLimit struct {
+	// Sustained request rate
+	RequestsPerSecond float64
+	// Number of requests that may be made back-to-back after a quiet period
+	Burst int
+	// Each request is delayed by a further random amount, up to this many seconds.
+	// Unset means DefaultJitterSeconds, so that 0 can turn jitter off.
+	JitterSeconds *float64
+}
+
+// Default for RateLimit.JitterSeconds
+const DefaultJitterSeconds = 0.5
+
+// Roughly matches the 0.5-1.5 second pause JTT has always taken between inmates,
+// but now applies to every JailTracker request, including captchas.
+var DefaultRateLimit = RateLimit{
+	RequestsPerSecond: 1,
+	Burst:             1,
+	JitterSeconds:     jitterSeconds(DefaultJitterSeconds),
+}
+
+// jitterSeconds returns a pointer to s, for RateLimit.JitterSeconds.
+func jitterSeconds(s float64) *float64 {
+	return &s
+}
+
+// jitter returns the jitter in seconds, which is 0 if unset. Policies in force have had withDefaults applied.
+func (r RateLimit) jitter() float64 {
+	if r.JitterSeconds == nil {
+		return 0
+	}
+	return *r.JitterSeconds
+}
+
+// withDefaults fills unset fields from DefaultRateLimit.
+func (r RateLimit) withDefaults() RateLimit {
+	if r.RequestsPerSecond <= 0 {
+		r.RequestsPerSecond = DefaultRateLimit.RequestsPerSecond
+	}
+	if r.Burst <= 0 {
+		r.Burst = DefaultRateLimit.Burst
+	}
+	if r.JitterSeconds == nil {
+		r.JitterSeconds = jitterSeconds(DefaultJitterSeconds)
+	} else {
+		r.JitterSeconds = jitterSeconds(max(*r.JitterSeconds, 0))
+	}
+	return r
+}
+
+// tighten returns the stricter of two policies, field by field.
+func (r RateLimit) tighten(other RateLimit) RateLimit {
+	return RateLimit{
+		RequestsPerSecond: min(r.RequestsPerSecond, other.RequestsPerSecond),
+		Burst:             min(r.Burst, other.Burst),
+		JitterSeconds:     jitterSeconds(max(r.jitter(), other.jitter())),
+	}
+}
+
+// validate checks a configured policy. A nil policy is valid, meaning the default.
+func (r *RateLimit) validate() error {
+	if r != nil && (r.RequestsPerSecond < 0 || r.Burst < 0 || r.jitter() < 0) {
+		return fmt.Errorf("RateLimit must not be negative: %v", *r)
+	}
+	return nil
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%g requests/second, burst %d, jitter up to %gs", r.RequestsPerSecond, r.Burst, r.jitter())
+}
+
+// RateLimiter is a token bucket with jitter, shared by every jail on a host.
+// Most jails share omsweb.public-safety-cloud.com, so crawling them in parallel
+// doesn't multiply the load on any one server.
+type RateLimiter struct {
+	mu    sync.Mutex
+	limit RateLimit
+	// Tokens available. Negative when callers are queued waiting for tokens.
+	tokens float64
+	last   time.Time
+	// Requests let through, for reporting
+	requests int
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	limit = limit.withDefaults()
+	return &RateLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until the caller may make a request, or ctx is done, in which case it returns ctx's error.
+// Each caller reserves a token up front, so concurrent callers are spaced out rather than released together.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.RequestsPerSecond)
+	l.last = now
+	l.tokens--
+	l.requests++
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.limit.RequestsPerSecond * float64(time.Second))
+	}
+	delay += time.Duration(rand.Float64() * l.limit.jitter() * float64(time.Second))
+	l.mu.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+// tighten applies a stricter policy, if other is stricter in any respect.
+func (l *RateLimiter) tighten(other RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = l.limit.tighten(other.withDefaults())
+	l.tokens = min(l.tokens, float64(l.limit.Burst))
+}
+
+// Limit returns the policy currently in force.
+func (l *RateLimiter) Limit() RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Requests returns the number of requests let through so far.
+func (l *RateLimiter) Requests() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	// Keyed by host. Only JailTracker hosts are registered; other requests aren't limited.
+	rateLimiters = map[string]*RateLimiter{}
+)
+
+// hostOf returns the host of a URL, or the string itself if it can't be parsed.
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// registerRateLimit sets up rate limiting for baseURL's host.
+// If jails sharing a host ask for different limits, the strictest setting of each kind wins.
+func registerRateLimit(baseURL string, limit RateLimit) *RateLimiter {
+	host := hostOf(baseURL)
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	limiter, ok := rateLimiters[host]
+	if !ok {
+		limiter = NewRateLimiter(limit)
+		rateLimiters[host] = limiter
+	} else {
+		limiter.tighten(limit)
+	}
+	return limiter
+}
+
+// waitForHost blocks until a request to rawURL's host is allowed, or ctx is done.
+// Requests to hosts without a registered limit, like OpenAI, go straight through.
+func waitForHost(ctx context.Context, rawURL string) error {
+	rateLimitersMu.Lock()
+	limiter := rateLimiters[hostOf(rawURL)]
+	rateLimitersMu.Unlock()
+	if limiter == nil {
+		return ctx.Err()
+	}
+	return limiter.Wait(ctx)
+}
+
+// RateLimitFor returns the policy for a jail: its own override if set, or the app-wide policy.
+func (config *AppConfig) RateLimitFor(jailConfig *JailConfig) RateLimit {
+	if jailConfig.RateLimit != nil {
+		return jailConfig.RateLimit.withDefaults()
+	}
+	if config.RateLimit != nil {
+		return config.RateLimit.withDefaults()
+	}
+	return DefaultRateLimit.withDefaults()
+}
+
+// registerRateLimits sets up rate limiting for every usable jail's host, before any crawling starts,
+// so that the strictest policy for each host is in force from the first request.
+func registerRateLimits(config *AppConfig) {
+	for i := range config.Jails {
+		jailConfig := &config.Jails[i]
+		if jailConfig.Usable {
+			registerRateLimit(jailConfig.BaseURL, config.RateLimitFor(jailConfig))
+		}
+	}
+}
+
+// rateLimitSummary describes the policy and request count for each host, sorted by host.
+func rateLimitSummary() []string {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	var lines []string
+	for host, limiter := range rateLimiters {
+		lines = append(lines, fmt.Sprintf("%s: %d requests (%s)", host, limiter.Requests(), limiter.Limit()))
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpacesCallers(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 50, Burst: 1, JitterSeconds: jitterSeconds(0)})
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+	// First caller goes immediately; the other three wait 20ms each
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Fatalf("concurrent callers weren't spaced out. Took %v", elapsed)
+	}
+	if got := limiter.Requests(); got != 4 {
+		t.Fatalf("unexpected request count. Got %d, want 4", got)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 3, JitterSeconds: jitterSeconds(0)})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("burst requests were delayed. Took %v", elapsed)
+	}
+}
+
+func TestRegisterRateLimitSharesHosts(t *testing.T) {
+	a := registerRateLimit("https://example-a.test", RateLimit{RequestsPerSecond: 2, Burst: 4, JitterSeconds: jitterSeconds(0.1)})
+	b := registerRateLimit("https://example-a.test/", RateLimit{RequestsPerSecond: 5, Burst: 2, JitterSeconds: jitterSeconds(0.7)})
+	c := registerRateLimit("https://example-b.test", RateLimit{})
+	if a != b {
+		t.Fatal("expected jails on the same host to share a limiter")
+	}
+	if a == c {
+		t.Fatal("expected jails on different hosts to have separate limiters")
+	}
+	want := RateLimit{RequestsPerSecond: 2, Burst: 2, JitterSeconds: jitterSeconds(0.7)}
+	if got := a.Limit(); got.String() != want.String() {
+		t.Fatalf("expected strictest limit to win. Got %s, want %s", got, want)
+	}
+	if got := c.Limit(); got.String() != DefaultRateLimit.String() {
+		t.Fatalf("expected defaults for unset fields. Got %s", got)
+	}
+}
+
+func TestRateLimitFor(t *testing.T) {
+	override := &RateLimit{RequestsPerSecond: 0.5}
+	config := &AppConfig{RateLimit: &RateLimit{RequestsPerSecond: 3, Burst: 2}}
+	if got := config.RateLimitFor(&JailConfig{RateLimit: override}); got.RequestsPerSecond != 0.5 || got.Burst != DefaultRateLimit.Burst {
+		t.Fatalf("expected jail override. Got %+v", got)
+	}
+	if got := config.RateLimitFor(&JailConfig{}); got.RequestsPerSecond != 3 || got.Burst != 2 {
+		t.Fatalf("expected app-wide limit. Got %+v", got)
+	}
+	if got := (&AppConfig{}).RateLimitFor(&JailConfig{}); got.String() != DefaultRateLimit.String() {
+		t.Fatalf("expected default limit. Got %s", got)
+	}
+	// Unset jitter is the default, but 0 turns it off
+	if got := config.RateLimitFor(&JailConfig{}); got.jitter() != DefaultJitterSeconds {
+		t.Fatalf("expected default jitter. Got %s", got)
+	}
+	noJitter := &JailConfig{RateLimit: &RateLimit{JitterSeconds: jitterSeconds(0)}}
+	if got := config.RateLimitFor(noJitter); got.jitter() != 0 {
+		t.Fatalf("expected no jitter. Got %s", got)
+	}
+}
+
+func TestRequestJSONWaitsForRegisteredHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	limiter := registerRateLimit(server.URL, RateLimit{RequestsPerSecond: 1000, Burst: 10, JitterSeconds: jitterSeconds(0)})
+	var res map[string]interface{}
+	for i := 0; i < 3; i++ {
+		if err := GetJSON(context.Background(), server.URL+"/x", nil, &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := limiter.Requests(); got != 3 {
+		t.Fatalf("expected every request to go through the limiter. Got %d, want 3", got)
+	}
+}
+
+func TestForEachJail(t *testing.T) {
+	jailConfigs := make([]*JailConfig, 10)
+	for i := range jailConfigs {
+		jailConfigs[i] = &JailConfig{Slug: string(rune('a' + i))}
+	}
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	running, maxRunning := 0, 0
+	forEachJail(context.Background(), jailConfigs, 3, func(jailConfig *JailConfig) {
+		mu.Lock()
+		seen[jailConfig.Slug] = true
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	if len(seen) != len(jailConfigs) {
+		t.Fatalf("unexpected jails visited. Got %d, want %d", len(seen), len(jailConfigs))
+	}
+	if maxRunning > 3 {
+		t.Fatalf("too many workers. Got %d, want at most 3", maxRunning)
+	}
+}
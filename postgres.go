@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+// Schema migrations for the shared Postgres database, applied in order by version, each exactly once.
+// Add a new file rather than editing one that's been applied anywhere.
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrationFiles embed.FS
+
+// Matches migration file names, like "0001_initial.sql", capturing the version
+var migrationNamePattern = regexp.MustCompile(`^(\d+)_[a-z0-9_]+\.sql$`)
+
+// Everything JTT creates goes under the jtt schema, out of the way of other tables.
+// This creates it, along with the table recording which migrations have been applied.
+const postgresSchema = `
+CREATE SCHEMA IF NOT EXISTS jtt;
+CREATE TABLE IF NOT EXISTS jtt.schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+`
+
+// Held while migrating, so two syncs starting at once don't both apply the same migration
+const postgresMigrationLock = 7_317_711
+
+type postgresMigration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// postgresMigrations returns the embedded migrations, sorted by version.
+func postgresMigrations() ([]postgresMigration, error) {
+	names, err := fs.Glob(postgresMigrationFiles, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []postgresMigration
+	seen := map[int]string{}
+	for _, name := range names {
+		base := path.Base(name)
+		m := migrationNamePattern.FindStringSubmatch(base)
+		if m == nil {
+			return nil, fmt.Errorf("migration %s isn't named like 0001_description.sql", base)
+		}
+		version, _ := strconv.Atoi(m[1])
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, base)
+		}
+		seen[version] = base
+		data, err := postgresMigrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, postgresMigration{Version: version, Name: base, SQL: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// PostgresTarget pushes snapshots to the shared research database.
+type PostgresTarget struct {
+	db *sql.DB
+}
+
+// OpenPostgresTarget connects to the database at dsn, a URL or key=value string as accepted by lib/pq.
+// Call Migrate before pushing anything.
+func OpenPostgresTarget(dsn string) (*PostgresTarget, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Postgres connection: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+	return &PostgresTarget{db: db}, nil
+}
+
+func (p *PostgresTarget) Close() error {
+	return p.db.Close()
+}
+
+// HasSchema reports whether the jtt tables have been created, without creating them.
+func (p *PostgresTarget) HasSchema() (bool, error) {
+	var exists bool
+	err := p.db.QueryRow(`SELECT to_regclass('jtt.crawls') IS NOT NULL`).Scan(&exists)
+	return exists, err
+}
+
+// Migrate applies pending migrations, each in its own transaction along with its row in jtt.schema_migrations,
+// and returns the names of those it applied.
+func (p *PostgresTarget) Migrate() ([]string, error) {
+	migrations, err := postgresMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.db.Exec(postgresSchema); err != nil {
+		return nil, fmt.Errorf("failed to create jtt schema: %w", err)
+	}
+	var applied []string
+	for _, migration := range migrations {
+		ok, err := p.applyMigration(migration)
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %s: %w", migration.Name, err)
+		}
+		if ok {
+			applied = append(applied, migration.Name)
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration applies a migration unless it already has been, reporting whether it did.
+func (p *PostgresTarget) applyMigration(migration postgresMigration) (bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock); err != nil {
+		return false, err
+	}
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM jtt.schema_migrations WHERE version = $1)`, migration.Version).Scan(&applied)
+	if err != nil || applied {
+		return false, err
+	}
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`INSERT INTO jtt.schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// snapshotHash returns the SHA-256 of the jail's JSON, to tell whether a pushed snapshot has changed since.
+func snapshotHash(jail *Jail) (string, error) {
+	data, err := json.Marshal(jail)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jail data: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Pushed reports whether this exact snapshot is already in the database.
+func (p *PostgresTarget) Pushed(jail *Jail, hash string) (bool, error) {
+	var pushed string
+	err := p.db.QueryRow(`SELECT snapshot_sha256 FROM jtt.crawls WHERE jail = $1 AND start_time_utc = $2`,
+		jail.Name, jail.StartTimeUTC).Scan(&pushed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up crawl: %w", err)
+	}
+	return pushed == hash, nil
+}
+
+// Push upserts a snapshot in one transaction. A crawl pushed before, say while it was incomplete,
+// keeps its ID but has its inmates replaced.
+func (p *PostgresTarget) Push(jail *Jail, hash string) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var end sql.NullTime
+	if !jail.EndTimeUTC.IsZero() {
+		end = sql.NullTime{Time: jail.EndTimeUTC, Valid: true}
+	}
+	stats := jail.CaptchaStats
+	var crawlID int64
+	err = tx.QueryRow(`INSERT INTO jtt.crawls (jail, start_time_utc, day, end_time_utc, base_url, incomplete,
+		captchas_fetched, captchas_solved, captcha_solver_errors, captchas_rejected_format, captchas_rejected_server,
+		captchas_accepted, prompt_tokens, completion_tokens, estimated_cost_usd, snapshot_sha256, time_zone)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (jail, start_time_utc) DO UPDATE SET
+			end_time_utc = EXCLUDED.end_time_utc, base_url = EXCLUDED.base_url, incomplete = EXCLUDED.incomplete,
+			captchas_fetched = EXCLUDED.captchas_fetched, captchas_solved = EXCLUDED.captchas_solved,
+			captcha_solver_errors = EXCLUDED.captcha_solver_errors,
+			captchas_rejected_format = EXCLUDED.captchas_rejected_format,
+			captchas_rejected_server = EXCLUDED.captchas_rejected_server,
+			captchas_accepted = EXCLUDED.captchas_accepted, prompt_tokens = EXCLUDED.prompt_tokens,
+			completion_tokens = EXCLUDED.completion_tokens, estimated_cost_usd = EXCLUDED.estimated_cost_usd,
+			snapshot_sha256 = EXCLUDED.snapshot_sha256, time_zone = EXCLUDED.time_zone, synced_at = now()
+		RETURNING id`,
+		jail.Name, jail.StartTimeUTC, jail.StartTimeUTC.UTC().Format(cacheDateFormat), end, jail.BaseURL,
+		jail.Incomplete, stats.Fetched, stats.Solved, stats.SolverErrors, stats.RejectedFormat, stats.RejectedServer,
+		stats.Accepted, stats.PromptTokens, stats.CompletionTokens, stats.EstimatedCostUSD, hash, jail.TimeZone).Scan(&crawlID)
+	if err != nil {
+		return fmt.Errorf("failed to upsert crawl: %w", err)
+	}
+	// Cascades to cases, charges, holds and special fields
+	if _, err := tx.Exec(`DELETE FROM jtt.inmates WHERE crawl_id = $1`, crawlID); err != nil {
+		return fmt.Errorf("failed to replace inmates: %w", err)
+	}
+	if err := copyInmates(tx, crawlID, jail.Inmates); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit crawl: %w", err)
+	}
+	return nil
+}
+
+// copyInmates bulk-loads a crawl's inmates and everything under them with COPY.
+func copyInmates(tx *sql.Tx, crawlID int64, inmates []Inmate) error {
+	err := copyRows(tx, `COPY jtt.inmates (crawl_id, position, arrest_no, original_book_date_time,
+		final_release_date_time, agency_name, jacket, fetch_status, fetch_attempts, fetch_last_error,
+		fetch_last_error_class, fetched_at_utc, original_book_date_time_parsed, final_release_date_time_parsed)
+		FROM STDIN`, func(row func(...any) error) error {
+		for i, inmate := range inmates {
+			var fetchedAt sql.NullTime
+			if inmate.Fetch.FetchedAtUTC != nil {
+				fetchedAt = sql.NullTime{Time: *inmate.Fetch.FetchedAtUTC, Valid: true}
+			}
+			err := row(crawlID, i, inmate.ArrestNo, inmate.OriginalBookDateTime, inmate.FinalReleaseDateTime,
+				inmate.AgencyName, inmate.Jacket, inmate.Fetch.Status, inmate.Fetch.Attempts, inmate.Fetch.LastError,
+				inmate.Fetch.LastErrorClass, fetchedAt, postgresParsedTime(inmate.Times.OriginalBookDateTime),
+				postgresParsedTime(inmate.Times.FinalReleaseDateTime))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy inmates: %w", err)
+	}
+
+	err = copyRows(tx, `COPY jtt.cases (crawl_id, inmate_position, position, case_no, status, bond_type,
+		bond_amount, fine_amount, sentence, court_time, court_time_parsed, bond_cents, fine_cents, sentence_years,
+		sentence_months, sentence_days, sentence_total_days) FROM STDIN`, func(row func(...any) error) error {
+		for i, inmate := range inmates {
+			for j, c := range inmate.Cases {
+				years, months, days, totalDays := sentenceColumns(c.Values.Sentence)
+				err := row(crawlID, i, j, c.CaseNo, c.Status, c.BondType, c.BondAmount, c.FineAmount, c.Sentence, c.CourtTime,
+					postgresParsedTime(c.Times.CourtTime), amountCents(c.Values.BondAmount),
+					amountCents(c.Values.FineAmount), years, months, days, totalDays)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy cases: %w", err)
+	}
+
+	err = copyRows(tx, `COPY jtt.charges (crawl_id, inmate_position, position, "case", case_no, crime_type,
+		control_number, warrant_number, arrest_code, charge_description, bond_type, bond_amount, court_type,
+		court_time, court_name, charge_status, offense_date, arrest_date, arresting_agency, court_time_parsed,
+		offense_date_parsed, arrest_date_parsed, bond_cents) FROM STDIN`,
+		func(row func(...any) error) error {
+			for i, inmate := range inmates {
+				for j, c := range inmate.Charges {
+					err := row(crawlID, i, j, c.Case, c.CaseNo, c.CrimeType, c.ControlNumber, c.WarrantNumber,
+						c.ArrestCode, c.ChargeDescription, c.BondType, c.BondAmount, c.CourtType, c.CourtTime,
+						c.CourtName, c.ChargeStatus, c.OffenseDate, c.ArrestDate, c.ArrestingAgency,
+						postgresParsedTime(c.Times.CourtTime), postgresParsedTime(c.Times.OffenseDate),
+						postgresParsedTime(c.Times.ArrestDate), amountCents(c.Values.BondAmount))
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("failed to copy charges: %w", err)
+	}
+
+	err = copyRows(tx, `COPY jtt.holds (crawl_id, inmate_position, position, data) FROM STDIN`,
+		func(row func(...any) error) error {
+			for i, inmate := range inmates {
+				for j, hold := range inmate.Holds {
+					data, err := json.Marshal(hold)
+					if err != nil {
+						return fmt.Errorf("failed to marshal hold: %w", err)
+					}
+					if err := row(crawlID, i, j, string(data)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("failed to copy holds: %w", err)
+	}
+
+	err = copyRows(tx, `COPY jtt.special_fields (crawl_id, inmate_position, label, value, value_parsed) FROM STDIN`,
+		func(row func(...any) error) error {
+			for i := range inmates {
+				specialTimes := inmates[i].specialFieldTimes()
+				for label, value := range inmates[i].specialFields() {
+					if *value == "" {
+						continue
+					}
+					if err := row(crawlID, i, label, *value, postgresParsedTime(specialTimes[label])); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("failed to copy special fields: %w", err)
+	}
+	return nil
+}
+
+// postgresParsedTime returns a parsed time for a nullable column.
+func postgresParsedTime(p *ParsedTime) sql.NullTime {
+	if t := parsedTimeValue(p); t != nil {
+		return sql.NullTime{Time: *t, Valid: true}
+	}
+	return sql.NullTime{}
+}
+
+// copyRows runs a COPY statement, with rows sent by calling row from f.
+func copyRows(tx *sql.Tx, query string, f func(row func(...any) error) error) error {
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	err = f(func(values ...any) error {
+		_, err := stmt.Exec(values...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// Flushes the rows
+	_, err = stmt.Exec()
+	return err
+}
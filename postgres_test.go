@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPostgresMigrations(t *testing.T) {
+	migrations, err := postgresMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("expected migrations starting at version 1. Got %+v", migrations)
+	}
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Fatalf("migrations out of order: %s after %s", migrations[i].Name, migrations[i-1].Name)
+		}
+	}
+}
+
+func TestSnapshotHash(t *testing.T) {
+	start := time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC)
+	jail := &Jail{Name: "a", StartTimeUTC: start, Inmates: []Inmate{{ArrestNo: "1"}}}
+	first, err := snapshotHash(jail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same snapshot, as read back from the cache
+	again, _ := snapshotHash(&Jail{Name: "a", StartTimeUTC: start, Inmates: []Inmate{{ArrestNo: "1"}}})
+	if first != again {
+		t.Fatalf("expected the same hash for the same snapshot. Got %s and %s", first, again)
+	}
+	jail.Inmates[0].Fetch.Status = FetchOK
+	if changed, _ := snapshotHash(jail); changed == first {
+		t.Fatal("expected a different hash once an inmate changes")
+	}
+}
+
+func TestSyncDays(t *testing.T) {
+	now := time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC)
+	if days, err := syncDays("", "", now); err != nil || len(days) != 1 || days[0] != nil {
+		t.Fatalf("expected just the latest snapshot by default. Got %v, %v", days, err)
+	}
+	days, err := syncDays("", "2024-07-14", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || days[0].Format(cacheDateFormat) != "2024-07-14" || days[2].Format(cacheDateFormat) != "2024-07-16" {
+		t.Fatalf("unexpected days since 2024-07-14: %v", days)
+	}
+	if _, err := syncDays("July 4", "", now); err == nil {
+		t.Fatal("expected error for a bad date")
+	}
+}
+
+// Runs against a real database, like a throwaway local one:
+//
+//	JTT_TEST_POSTGRES_DSN='postgres://postgres@localhost/jtt_test?sslmode=disable' go test -run Postgres
+//
+// It drops and recreates the jtt schema, so don't point it at the shared database.
+func TestPostgresTargetPush(t *testing.T) {
+	dsn := os.Getenv("JTT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("JTT_TEST_POSTGRES_DSN not set")
+	}
+	target, err := OpenPostgresTarget(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	if _, err := target.db.Exec(`DROP SCHEMA IF EXISTS jtt CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	if hasSchema, err := target.HasSchema(); err != nil || hasSchema {
+		t.Fatalf("expected no schema yet. Got %t, %v", hasSchema, err)
+	}
+	if applied, err := target.Migrate(); err != nil || len(applied) == 0 {
+		t.Fatalf("expected migrations to be applied. Got %v, %v", applied, err)
+	}
+	if applied, err := target.Migrate(); err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing left to migrate. Got %v, %v", applied, err)
+	}
+
+	fetched := time.Date(2024, 7, 16, 3, 5, 0, 0, time.UTC)
+	jail := &Jail{
+		Name:         "a",
+		StartTimeUTC: time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC),
+		Incomplete:   true,
+		Inmates: []Inmate{
+			{
+				ArrestNo:           "1",
+				Cases:              []Case{{CaseNo: "C1", BondAmount: 500, Sentence: "1y 6m 0d"}},
+				Charges:            []Charge{{CaseNo: "C1", ChargeDescription: "Theft"}},
+				Holds:              []Hold{{"agency": "ICE"}},
+				SpecialBookingDate: "07/16/2024",
+				Fetch:              InmateFetch{Status: FetchOK, Attempts: 1, FetchedAtUTC: &fetched},
+			},
+			{ArrestNo: "2", Fetch: InmateFetch{Status: FetchPending}},
+		},
+	}
+	jail.Parse(time.UTC)
+	push := func() {
+		t.Helper()
+		hash, err := snapshotHash(jail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := target.Push(jail, hash); err != nil {
+			t.Fatal(err)
+		}
+		if pushed, err := target.Pushed(jail, hash); err != nil || !pushed {
+			t.Fatalf("expected the snapshot to be marked pushed. Got %t, %v", pushed, err)
+		}
+	}
+	count := func(table string) int {
+		t.Helper()
+		var n int
+		if err := target.db.QueryRow(`SELECT count(*) FROM jtt.` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	push()
+	// Pushing the same crawl again, once it's finished, replaces it rather than adding another
+	jail.Incomplete = false
+	jail.Inmates[1].Fetch.Status = FetchOK
+	jail.Inmates[1].Charges = []Charge{{ChargeDescription: "Trespass"}}
+	push()
+	for table, want := range map[string]int{"crawls": 1, "inmates": 2, "cases": 1, "charges": 2, "holds": 1, "special_fields": 1} {
+		if got := count(table); got != want {
+			t.Errorf("unexpected rows in %s. Got %d, want %d", table, got, want)
+		}
+	}
+	var bookingDate time.Time
+	err = target.db.QueryRow(`SELECT value_parsed FROM jtt.special_fields WHERE label = 'Booking Date:'`).Scan(&bookingDate)
+	if err != nil || !bookingDate.Equal(time.Date(2024, 7, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected parsed booking date %v: %v", bookingDate, err)
+	}
+	var bondCents, sentenceDays int64
+	err = target.db.QueryRow(`SELECT bond_cents, sentence_total_days FROM jtt.cases`).Scan(&bondCents, &sentenceDays)
+	if err != nil || bondCents != 50000 || sentenceDays != 545 {
+		t.Fatalf("unexpected parsed case. Got %d cents and %d days, %v", bondCents, sentenceDays, err)
+	}
+	var incomplete bool
+	if err := target.db.QueryRow(`SELECT incomplete FROM jtt.crawls`).Scan(&incomplete); err != nil || incomplete {
+		t.Fatalf("expected the finished crawl. Got incomplete=%t, %v", incomplete, err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// What happened to a jail during a run
+const (
+	// Not Usable in config
+	OutcomeSkipped = "skipped"
+	// Today's complete snapshot was already cached
+	OutcomeCached = "cached"
+	// Crawled, or an incomplete crawl resumed, to completion
+	OutcomeCrawled = "crawled"
+	// Crawl failed or was cut short. Partial data may still have been saved.
+	OutcomeFailed = "failed"
+	// The run was interrupted before this jail was started
+	OutcomeNotRun = "not-run"
+)
+
+// JailReport summarizes one jail's part in a run.
+type JailReport struct {
+	Slug    string
+	Outcome string
+	// Inmates listed, and how many of their detail fetches succeeded and failed
+	Inmates        int
+	DetailsFetched int
+	DetailsFailed  int
+	// Captchas fetched and accepted, over the whole snapshot (including earlier runs, for cached or resumed jails)
+	CaptchasFetched  int
+	CaptchasAccepted int
+	EstimatedCostUSD float64
+	// Time this run spent on the jail
+	DurationSeconds float64
+	Error           string `json:",omitempty"`
+}
+
+// DetailSuccessRate returns the fraction of inmates whose details were fetched, or 0 if there are no inmates.
+func (r *JailReport) DetailSuccessRate() float64 {
+	if r.Inmates == 0 {
+		return 0
+	}
+	return float64(r.DetailsFetched) / float64(r.Inmates)
+}
+
+// newJailReport summarizes a jail. jail may be nil if nothing was loaded or crawled.
+func newJailReport(jailConfig *JailConfig, outcome string, jail *Jail, duration time.Duration, err error) JailReport {
+	report := JailReport{
+		Slug:            jailConfig.Slug,
+		Outcome:         outcome,
+		DurationSeconds: duration.Seconds(),
+	}
+	if jail != nil {
+		report.Inmates = len(jail.Inmates)
+		report.DetailsFetched, report.DetailsFailed, _ = jail.FetchCounts()
+		report.CaptchasFetched = jail.CaptchaStats.Fetched
+		report.CaptchasAccepted = jail.CaptchaStats.Accepted
+		report.EstimatedCostUSD = jail.CaptchaStats.EstimatedCostUSD
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+// RunReport summarizes a run of JTT, with one row per configured jail.
+type RunReport struct {
+	StartTimeUTC time.Time
+	EndTimeUTC   time.Time
+	// Set if the run was stopped by a signal
+	Interrupted bool
+	Jails       []JailReport
+}
+
+// Count returns the number of jails with the given outcome.
+func (r *RunReport) Count(outcome string) int {
+	n := 0
+	for _, jail := range r.Jails {
+		if jail.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes the report as a table, followed by totals.
+// Cached jails' costs were spent by earlier runs, so they're totalled separately from this run's.
+func (r *RunReport) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JAIL\tOUTCOME\tINMATES\tDETAILS\tCAPTCHAS\tCOST\tDURATION\tERROR")
+	cost, cachedCost := 0.0, 0.0
+	for _, jail := range r.Jails {
+		details := "-"
+		if jail.Inmates > 0 {
+			details = fmt.Sprintf("%.0f%%", 100*jail.DetailSuccessRate())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d/%d\t$%.4f\t%v\t%s\n",
+			jail.Slug, jail.Outcome, jail.Inmates, details, jail.CaptchasAccepted, jail.CaptchasFetched,
+			jail.EstimatedCostUSD, time.Duration(jail.DurationSeconds*float64(time.Second)).Round(time.Second), jail.Error)
+		switch jail.Outcome {
+		case OutcomeCrawled, OutcomeFailed:
+			cost += jail.EstimatedCostUSD
+		case OutcomeCached:
+			cachedCost += jail.EstimatedCostUSD
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d jails: %d crawled, %d cached, %d failed, %d skipped, %d not run. Estimated captcha cost: $%.4f",
+		len(r.Jails), r.Count(OutcomeCrawled), r.Count(OutcomeCached), r.Count(OutcomeFailed),
+		r.Count(OutcomeSkipped), r.Count(OutcomeNotRun), cost)
+	if cachedCost > 0 {
+		fmt.Fprintf(w, " (plus $%.4f spent earlier on cached snapshots)", cachedCost)
+	}
+	fmt.Fprintln(w)
+	if r.Interrupted {
+		fmt.Fprintln(w, "Run was interrupted.")
+	}
+	return nil
+}
+
+// Save writes the report as JSON to dir, named for the run's start time, returning the path.
+func (r *RunReport) Save(dir string) (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal run report: %w", err)
+	}
+	filename := path.Join(dir, fmt.Sprintf("run-%s.json", r.StartTimeUTC.Format("20060102T150405Z")))
+	if err := writeFileAtomic(filename, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write run report: %w", err)
+	}
+	return filename, nil
+}
+
+// LatestJailReports reads every run report saved in dir, returning each jail's row from the most recent
+// report that ran it. Runs filtered to a few jails only report on those, so a jail's latest outcome may
+// come from an older report. Rows for jails an interrupted run never started are passed over the same way.
+// If there are no reports, the error wraps os.ErrNotExist.
+func LatestJailReports(dir string) (map[string]JailReport, error) {
+	filenames, err := filepath.Glob(path.Join(dir, "run-*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run reports: %w", err)
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no run reports in %s: %w", dir, os.ErrNotExist)
+	}
+	// Names are timestamps, so they sort by time. Newest first, so the first row for a jail wins.
+	sort.Sort(sort.Reverse(sort.StringSlice(filenames)))
+	latest := map[string]JailReport{}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read run report: %w", err)
+		}
+		report := &RunReport{}
+		if err := json.Unmarshal(data, report); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal run report %s: %w", filename, err)
+		}
+		for _, jail := range report.Jails {
+			if _, ok := latest[jail.Slug]; ok || jail.Outcome == OutcomeNotRun {
+				continue
+			}
+			latest[jail.Slug] = jail
+		}
+	}
+	return latest, nil
+}
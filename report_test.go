@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewJailReport(t *testing.T) {
+	jail := &Jail{
+		Inmates: []Inmate{
+			{Fetch: InmateFetch{Status: FetchOK}},
+			{Fetch: InmateFetch{Status: FetchOK}},
+			{Fetch: InmateFetch{Status: FetchFailed}},
+			{Fetch: InmateFetch{Status: FetchPending}},
+		},
+		CaptchaStats: CaptchaStats{Fetched: 3, Accepted: 2, EstimatedCostUSD: 0.01},
+	}
+	report := newJailReport(&JailConfig{Slug: "test"}, OutcomeFailed, jail, 2*time.Second, errors.New("boom"))
+	want := JailReport{
+		Slug:             "test",
+		Outcome:          OutcomeFailed,
+		Inmates:          4,
+		DetailsFetched:   2,
+		DetailsFailed:    1,
+		CaptchasFetched:  3,
+		CaptchasAccepted: 2,
+		EstimatedCostUSD: 0.01,
+		DurationSeconds:  2,
+		Error:            "boom",
+	}
+	if report != want {
+		t.Fatalf("unexpected report.\nGot  %+v\nWant %+v", report, want)
+	}
+	if rate := report.DetailSuccessRate(); rate != 0.5 {
+		t.Fatalf("unexpected success rate. Got %v, want 0.5", rate)
+	}
+
+	empty := newJailReport(&JailConfig{Slug: "skip"}, OutcomeSkipped, nil, 0, nil)
+	if empty.Inmates != 0 || empty.Error != "" || empty.DetailSuccessRate() != 0 {
+		t.Fatalf("unexpected report for skipped jail: %+v", empty)
+	}
+}
+
+func TestRunReportPrintAndSave(t *testing.T) {
+	report := &RunReport{
+		StartTimeUTC: time.Date(2024, 7, 16, 3, 0, 0, 0, time.UTC),
+		Jails: []JailReport{
+			{Slug: "crawled-jail", Outcome: OutcomeCrawled, Inmates: 10, DetailsFetched: 9, EstimatedCostUSD: 0.02},
+			{Slug: "broken-jail", Outcome: OutcomeFailed, Error: "captcha service failed"},
+			{Slug: "off-jail", Outcome: OutcomeSkipped},
+			{Slug: "cached-jail", Outcome: OutcomeCached, EstimatedCostUSD: 0.5},
+		},
+	}
+	var out bytes.Buffer
+	if err := report.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	for _, want := range []string{"crawled-jail", "90%", "broken-jail", "captcha service failed", "1 crawled", "1 failed", "1 skipped",
+		"Estimated captcha cost: $0.0200 (plus $0.5000 spent earlier on cached snapshots)"} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("expected %q in printed report:\n%s", want, printed)
+		}
+	}
+
+	filename, err := report.Save(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(filename, "run-20240716T030000Z.json") {
+		t.Fatalf("unexpected report file name: %s", filename)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := &RunReport{}
+	if err := json.Unmarshal(data, saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Jails) != 4 || saved.Jails[1].Error != "captcha service failed" {
+		t.Fatalf("unexpected saved report: %+v", saved)
+	}
+}
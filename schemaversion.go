@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+)
+
+// SnapshotVersion is the version of the snapshot format this build writes, saved in Jail.SchemaVersion.
+// Bump it, and add a step to snapshotUpgrades, whenever a change to Jail or the types under it
+// would stop older snapshots from loading as they were meant.
+const SnapshotVersion = 2
+
+// Snapshots from before SchemaVersion was added have none, and count as version 1
+const unversionedSnapshot = 1
+
+// snapshotUpgrades[v] upgrades a snapshot's top-level JSON fields from version v to v+1.
+// Steps work on raw JSON rather than Jail, since old snapshots may not fit the current struct.
+var snapshotUpgrades = map[int]func(fields map[string]json.RawMessage) error{
+	// Jail.Offenders was renamed Inmates
+	1: renameSnapshotField("Offenders", "Inmates"),
+}
+
+// errNewerSnapshot is wrapped by errors reading snapshots written by a newer JTT.
+// These aren't corrupt, so they're left alone rather than quarantined.
+var errNewerSnapshot = errors.New("snapshot is from a newer version of jtt")
+
+// upgradeSnapshot upgrades snapshot JSON to SnapshotVersion, returning it along with the version it was.
+// Current snapshots are returned as is.
+func upgradeSnapshot(data []byte) ([]byte, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, err
+	}
+	if fields == nil {
+		return nil, 0, errors.New("not a JSON object")
+	}
+	version := unversionedSnapshot
+	if raw, ok := fields["SchemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("invalid SchemaVersion: %w", err)
+		}
+	}
+	if version < unversionedSnapshot {
+		return nil, version, fmt.Errorf("invalid SchemaVersion %d", version)
+	}
+	if version > SnapshotVersion {
+		return nil, version, fmt.Errorf("%w: version %d, but this one reads up to %d", errNewerSnapshot, version, SnapshotVersion)
+	}
+	if version == SnapshotVersion {
+		return data, version, nil
+	}
+	for v := version; v < SnapshotVersion; v++ {
+		upgrade := snapshotUpgrades[v]
+		if upgrade == nil {
+			return nil, version, fmt.Errorf("no upgrade from version %d", v)
+		}
+		if err := upgrade(fields); err != nil {
+			return nil, version, fmt.Errorf("failed to upgrade from version %d: %w", v, err)
+		}
+	}
+	fields["SchemaVersion"] = json.RawMessage(fmt.Sprint(SnapshotVersion))
+	upgraded, err := json.Marshal(fields)
+	return upgraded, version, err
+}
+
+// renameSnapshotField returns an upgrade step that renames a top-level field.
+func renameSnapshotField(from, to string) func(map[string]json.RawMessage) error {
+	return func(fields map[string]json.RawMessage) error {
+		raw, ok := fields[from]
+		if !ok {
+			return nil
+		}
+		if _, ok := fields[to]; ok {
+			return fmt.Errorf("has both %s and %s", from, to)
+		}
+		fields[to] = raw
+		delete(fields, from)
+		return nil
+	}
+}
+
+// runMigrateCache implements `jtt migrate-cache`, which rewrites JSON snapshots from older versions
+// in the current format, in place and in the same compression format.
+// Snapshots are read in any version anyway, so this only saves upgrading them on every read.
+func runMigrateCache(args []string) error {
+	flags := flag.NewFlagSet("migrate-cache", flag.ContinueOnError)
+	addCacheFlag(flags)
+	dryRun := flags.Bool("dry-run", false, "list the snapshots that would be upgraded, without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(appConfig.Cache)
+	if err != nil {
+		return fmt.Errorf("failed to list cache directory: %w", err)
+	}
+	var upgraded, current, skipped int
+	for _, entry := range entries {
+		_, _, ext, ok := parseSnapshotName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		filename := path.Join(appConfig.Cache, entry.Name())
+		version, err := migrateSnapshot(filename, compressionForExt(ext), *dryRun)
+		if errors.Is(err, errCorruptSnapshot) || errors.Is(err, errNewerSnapshot) {
+			log.Printf("Skipping %v", err)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", filename, err)
+		}
+		if version == SnapshotVersion {
+			current++
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("%s\tversion %d\n", filename, version)
+		}
+		upgraded++
+	}
+
+	if *dryRun {
+		log.Printf("Would upgrade %d snapshots to version %d. %d already current, %d skipped.", upgraded, SnapshotVersion, current, skipped)
+		return nil
+	}
+	log.Printf("Upgraded %d snapshots to version %d. %d already current, %d skipped.", upgraded, SnapshotVersion, current, skipped)
+	return nil
+}
+
+// migrateSnapshot rewrites a snapshot in the current version unless it already is, returning the version it was.
+func migrateSnapshot(filename string, format string, dryRun bool) (int, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	data, err := decompress(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%w \"%s\": %w", errCorruptSnapshot, filename, err)
+	}
+	jail, err := decodeSnapshot(filename, data)
+	if err != nil {
+		return 0, err
+	}
+	if jail.readVersion == SnapshotVersion || dryRun {
+		return jail.readVersion, nil
+	}
+	data, err = json.MarshalIndent(jail, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal jail data: %w", err)
+	}
+	return jail.readVersion, writeSnapshot(filename, data, format)
+}
+
+// compressionForExt returns the compression format of a snapshot file extension.
+func compressionForExt(ext string) string {
+	for format, formatExt := range compressionExts {
+		if ext == formatExt {
+			return format
+		}
+	}
+	return CompressionNone
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// As written before SchemaVersion was added
+const unversionedSnapshotJSON = `{
+  "BaseURL": "https://omsweb.public-safety-cloud.com",
+  "Name": "a",
+  "Offenders": [{"arrestNo": "1", "fetch": {"status": "ok", "attempts": 1}}, {"arrestNo": "2"}],
+  "StartTimeUTC": "2024-07-16T03:00:00Z",
+  "EndTimeUTC": "2024-07-16T04:00:00Z"
+}`
+
+func TestUpgradeSnapshot(t *testing.T) {
+	tests := []struct {
+		Name        string
+		JSON        string
+		WantVersion int
+		WantErr     bool
+	}{
+		{"unversioned", unversionedSnapshotJSON, 1, false},
+		{"current", `{"SchemaVersion": 2, "Name": "a", "Inmates": []}`, 2, false},
+		{"newer", `{"SchemaVersion": 99, "Name": "a"}`, 99, true},
+		{"zero", `{"SchemaVersion": 0, "Name": "a"}`, 0, true},
+		{"negative", `{"SchemaVersion": -1, "Name": "a"}`, -1, true},
+		{"both names", `{"Name": "a", "Offenders": [], "Inmates": []}`, 1, true},
+		{"not an object", `null`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, version, err := upgradeSnapshot([]byte(tt.JSON))
+			if (err != nil) != tt.WantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tt.WantVersion {
+				t.Fatalf("unexpected version. Got %d, want %d", version, tt.WantVersion)
+			}
+		})
+	}
+	if _, err := decodeSnapshot("a.json", []byte(`{"SchemaVersion": 0, "Name": "a"}`)); !errors.Is(err, errCorruptSnapshot) {
+		t.Fatalf("expected an invalid version to be corrupt. Got %v", err)
+	}
+	current := `{"SchemaVersion": 2, "Name": "a"}`
+	if data, _, _ := upgradeSnapshot([]byte(current)); string(data) != current {
+		t.Fatalf("expected a current snapshot as is. Got %s", data)
+	}
+}
+
+func TestReadUnversionedSnapshot(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+	if err := os.WriteFile(path.Join(store.Dir, "a-2024-07-16.json"), []byte(unversionedSnapshotJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jail, _, err := store.Latest("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jail.Inmates) != 2 || jail.Inmates[0].Fetch.Status != FetchOK {
+		t.Fatalf("expected inmates from the old Offenders field. Got %+v", jail.Inmates)
+	}
+	if jail.SchemaVersion != SnapshotVersion || jail.readVersion != unversionedSnapshot {
+		t.Fatalf("unexpected versions. Got %d, read as %d", jail.SchemaVersion, jail.readVersion)
+	}
+}
+
+func TestNewerSnapshotIsNotQuarantined(t *testing.T) {
+	store := &JSONStore{Dir: t.TempDir()}
+	filename := path.Join(store.Dir, "a-2024-07-16.json")
+	if err := os.WriteFile(filename, []byte(`{"SchemaVersion": 99, "Name": "a", "StartTimeUTC": "2024-07-16T03:00:00Z"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadJailCached(context.Background(), store, &JailConfig{Slug: "a"}, CachePolicy{Mode: CacheOnly})
+	if !errors.Is(err, errNewerSnapshot) {
+		t.Fatalf("expected errNewerSnapshot. Got %v", err)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatalf("expected the snapshot to be left in place. Got %v", err)
+	}
+}
+
+func TestMigrateSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	filename := path.Join(dir, "a-2024-07-16.json.gz")
+	if err := writeSnapshot(filename, []byte(unversionedSnapshotJSON), CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	version, err := migrateSnapshot(filename, CompressionGzip, false)
+	if err != nil || version != unversionedSnapshot {
+		t.Fatalf("expected to upgrade from version 1. Got %d, %v", version, err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := decompress(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Offenders") || !strings.Contains(string(data), `"SchemaVersion": 2`) {
+		t.Fatalf("expected the snapshot in the current format. Got %s", data)
+	}
+	if version, err := migrateSnapshot(filename, CompressionGzip, false); err != nil || version != SnapshotVersion {
+		t.Fatalf("expected the snapshot to be current. Got %d, %v", version, err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSolver is used when neither the app config nor the jail config names a solver.
+const DefaultSolver = "openai"
+
+// Limit on how deeply chains and votes can nest, which also catches cycles in config
+const maxSolverDepth = 8
+
+// CaptchaGuess is a solver's reading of a captcha image.
+type CaptchaGuess struct {
+	// The text the solver believes is pictured
+	Text string
+	// Confidence in [0, 1]. Solvers that can't estimate this report 1.
+	Confidence float64
+	// Type of solver that produced the guess, e.g. "openai"
+	Solver string
+	// Tokens billed and estimated spend, for solvers backed by a paid API. Zero otherwise.
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+}
+
+// CaptchaSolver reads the text from a captcha image.
+// The image is passed as it's received from JailTracker: an inline "data:image/gif;base64,..." URL.
+type CaptchaSolver interface {
+	Solve(ctx context.Context, inlineImage string) (*CaptchaGuess, error)
+}
+
+// CaptchaFeedback is implemented by solvers that want to know whether JailTracker accepted their answers.
+type CaptchaFeedback interface {
+	Verdict(guess *CaptchaGuess, matched bool)
+}
+
+// SolverConfig describes a named solver in config.json.
+type SolverConfig struct {
+	// Implementation to use: "openai", "local", "human", "chain" or "vote"
+	Type string
+	// For "local": path to an OCR model file. Defaults to the model shipped with JTT.
+	ModelPath string
+	// For "openai": base URL of the API, for OpenAI-compatible servers.
+	// Defaults to JTT_OPENAI_BASE_URL, or DefaultOpenAIBaseURL.
+	BaseURL string
+	// For "openai": model name. Defaults to JTT_OPENAI_MODEL, or DefaultOpenAIModel.
+	Model string
+	// For "openai": system prompt. Defaults to JTT_OPENAI_PROMPT, or DefaultOpenAIPrompt.
+	Prompt string
+	// For "openai": sampling temperature. Defaults to JTT_OPENAI_TEMPERATURE, or else the server's default.
+	Temperature *float64
+	// For "openai": token limit for the reply. Defaults to JTT_OPENAI_MAX_TOKENS, or DefaultOpenAIMaxTokens.
+	MaxTokens int
+	// For "openai": US dollars per million prompt and completion tokens, for cost estimates.
+	// Default to DefaultOpenAIPromptPrice and DefaultOpenAICompletionPrice.
+	PromptPrice     float64
+	CompletionPrice float64
+	// For "chain" and "vote": names of the solvers to combine, cheapest first
+	Members []string
+	// For "chain": escalate to the next member when confidence is below this
+	MinConfidence float64
+	// For "human": "terminal" (default) or "web"
+	Mode string
+	// For "human" in "web" mode: address to serve the captcha page on. Defaults to DefaultHumanAddr.
+	Addr string
+	// For "human": how long to wait for an answer. Defaults to DefaultHumanTimeout.
+	TimeoutSeconds int
+}
+
+// SolverName returns the name of the solver to use for a jail.
+// The jail's own setting wins, then the app-wide setting, then DefaultSolver.
+func (config *AppConfig) SolverName(jailConfig *JailConfig) string {
+	if jailConfig != nil && jailConfig.Solver != "" {
+		return jailConfig.Solver
+	}
+	if config.Solver != "" {
+		return config.Solver
+	}
+	return DefaultSolver
+}
+
+// solverConfig looks up a solver by name.
+// Names not defined under "Solvers" are treated as a bare Type with default settings,
+// so "openai" works without any extra config.
+func (config *AppConfig) solverConfig(name string) SolverConfig {
+	if solverConfig, ok := config.Solvers[name]; ok {
+		if solverConfig.Type == "" {
+			solverConfig.Type = name
+		}
+		return solverConfig
+	}
+	return SolverConfig{Type: name}
+}
+
+// NewSolver builds the named solver.
+func (config *AppConfig) NewSolver(name string) (CaptchaSolver, error) {
+	return config.newSolver(name, 0)
+}
+
+func (config *AppConfig) newSolver(name string, depth int) (CaptchaSolver, error) {
+	if depth > maxSolverDepth {
+		return nil, fmt.Errorf(`solver "%s" is nested too deeply; check for a cycle in Members`, name)
+	}
+	solverConfig := config.solverConfig(name)
+	switch solverConfig.Type {
+	case "openai":
+		solver := NewOpenAISolver(config.openAIBaseURL(solverConfig), appEnv.OpenAIAPIKey)
+		if err := appEnv.applyOpenAIDefaults(solver); err != nil {
+			return nil, err
+		}
+		if solverConfig.Model != "" {
+			solver.Model = solverConfig.Model
+		}
+		if solverConfig.Prompt != "" {
+			solver.Prompt = solverConfig.Prompt
+		}
+		if solverConfig.MaxTokens > 0 {
+			solver.MaxTokens = solverConfig.MaxTokens
+		}
+		if solverConfig.Temperature != nil {
+			solver.Temperature = solverConfig.Temperature
+		}
+		if solverConfig.PromptPrice != 0 {
+			solver.PromptPrice = solverConfig.PromptPrice
+		}
+		if solverConfig.CompletionPrice != 0 {
+			solver.CompletionPrice = solverConfig.CompletionPrice
+		}
+		return solver, nil
+	case "local":
+		return NewLocalSolver(solverConfig.ModelPath)
+	case "human":
+		solver, err := NewHumanSolver(solverConfig.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if solverConfig.Addr != "" {
+			solver.Addr = solverConfig.Addr
+		}
+		if solverConfig.TimeoutSeconds > 0 {
+			solver.Timeout = time.Duration(solverConfig.TimeoutSeconds) * time.Second
+		}
+		return solver, nil
+	case "chain", "vote":
+		if len(solverConfig.Members) == 0 {
+			return nil, fmt.Errorf(`solver "%s" has no Members`, name)
+		}
+		members := make([]CaptchaSolver, len(solverConfig.Members))
+		for i, memberName := range solverConfig.Members {
+			member, err := config.newSolver(memberName, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			members[i] = member
+		}
+		if solverConfig.Type == "vote" {
+			return &VotingSolver{Members: members}, nil
+		}
+		return &ChainSolver{Members: members, MinConfidence: solverConfig.MinConfidence}, nil
+	default:
+		return nil, fmt.Errorf(`unknown type "%s" for solver "%s"`, solverConfig.Type, name)
+	}
+}
+
+// openAIBaseURL resolves the API base URL for an OpenAI solver.
+func (config *AppConfig) openAIBaseURL(solverConfig SolverConfig) string {
+	if solverConfig.BaseURL != "" {
+		return solverConfig.BaseURL
+	}
+	if appEnv.OpenAIBaseURL != "" {
+		return appEnv.OpenAIBaseURL
+	}
+	return DefaultOpenAIBaseURL
+}
+
+// isOpenAIURL reports whether an API base URL is OpenAI's own, by host, however it's written.
+// URLs that don't parse count as OpenAI's, so they're never sent without a key by mistake.
+func isOpenAIURL(baseURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil || u.Hostname() == "" {
+		return true
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	return host == "openai.com" || strings.HasSuffix(host, ".openai.com")
+}
+
+// NeedsOpenAIKey reports whether any usable jail will need an OpenAI API key.
+func (config *AppConfig) NeedsOpenAIKey() bool {
+	for i := range config.Jails {
+		jailConfig := &config.Jails[i]
+		if !jailConfig.Usable {
+			continue
+		}
+		if config.solverNeedsOpenAIKey(config.SolverName(jailConfig), 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// solverNeedsOpenAIKey reports whether the named solver, or any solver it combines, calls the OpenAI API.
+// Solvers pointed at other OpenAI-compatible servers may not need a key, so they don't count.
+func (config *AppConfig) solverNeedsOpenAIKey(name string, depth int) bool {
+	solverConfig := config.solverConfig(name)
+	if solverConfig.Type == "openai" {
+		return isOpenAIURL(config.openAIBaseURL(solverConfig))
+	}
+	if depth > maxSolverDepth {
+		return false
+	}
+	for _, member := range solverConfig.Members {
+		if config.solverNeedsOpenAIKey(member, depth+1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewSolver(t *testing.T) {
+	config := &AppConfig{
+		Solvers: map[string]SolverConfig{
+			"gpt": {Type: "openai"},
+		},
+	}
+	for _, name := range []string{"openai", "gpt"} {
+		solver, err := config.NewSolver(name)
+		if err != nil {
+			t.Fatalf(`unexpected error for solver "%s": %v`, name, err)
+		}
+		if _, ok := solver.(*OpenAISolver); !ok {
+			t.Fatalf(`expected OpenAISolver for "%s", got %T`, name, solver)
+		}
+	}
+	if _, err := config.NewSolver("nope"); err == nil {
+		t.Fatal("expected error for unknown solver, got nil")
+	}
+
+	jailConfig := &JailConfig{Slug: "test"}
+	if got := config.SolverName(jailConfig); got != DefaultSolver {
+		t.Fatalf("unexpected default solver. Got %s, want %s", got, DefaultSolver)
+	}
+	config.Solver = "gpt"
+	if got := config.SolverName(jailConfig); got != "gpt" {
+		t.Fatalf("unexpected app solver. Got %s, want gpt", got)
+	}
+	jailConfig.Solver = "openai"
+	if got := config.SolverName(jailConfig); got != "openai" {
+		t.Fatalf("unexpected jail solver. Got %s, want openai", got)
+	}
+}
+
+func TestValidateRequiredLocalSolver(t *testing.T) {
+	env := &AppEnv{}
+	config := &AppConfig{
+		Solver: "local",
+		Jails: []JailConfig{
+			{Slug: "local", Usable: true},
+			// Unusable jails don't count
+			{Slug: "unused", Usable: false, Solver: "openai"},
+		},
+	}
+	if err := env.ValidateRequired(config); err != nil {
+		t.Fatalf("unexpected error with only local solvers: %v", err)
+	}
+	config.Jails[0].Solver = "openai"
+	if err := env.ValidateRequired(config); err == nil {
+		t.Fatal("expected error for missing OpenAI key, got nil")
+	}
+}
+
+func TestNewSolverOpenAISettings(t *testing.T) {
+	defer func(env AppEnv) { *appEnv = env }(*appEnv)
+	appEnv.OpenAIModel = "env-model"
+	appEnv.OpenAIBaseURL = ""
+
+	temperature := 0.2
+	config := &AppConfig{
+		Solvers: map[string]SolverConfig{
+			"self-hosted": {
+				Type:        "openai",
+				BaseURL:     "http://localhost:8000/v1/",
+				Model:       "llava",
+				Prompt:      "TEST_PROMPT",
+				Temperature: &temperature,
+				MaxTokens:   8,
+			},
+		},
+	}
+	solver, err := config.NewSolver("self-hosted")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := solver.(*OpenAISolver)
+	if s.URL != "http://localhost:8000/v1/chat/completions" || s.Model != "llava" || s.Prompt != "TEST_PROMPT" ||
+		s.MaxTokens != 8 || *s.Temperature != 0.2 {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+	// Self-hosted servers don't need an OpenAI key
+	if config.solverNeedsOpenAIKey("self-hosted", 0) {
+		t.Fatal("expected self-hosted solver not to need an OpenAI key")
+	}
+
+	solver, err = config.NewSolver("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s = solver.(*OpenAISolver)
+	if s.URL != DefaultOpenAIBaseURL+"/chat/completions" || s.Model != "env-model" || s.Prompt != DefaultOpenAIPrompt {
+		t.Fatalf("unexpected default settings: %+v", s)
+	}
+	if !config.solverNeedsOpenAIKey("openai", 0) {
+		t.Fatal("expected default solver to need an OpenAI key")
+	}
+}
+
+func TestNewSolverOpenAIEnvDefaults(t *testing.T) {
+	defer func(env AppEnv) { *appEnv = env }(*appEnv)
+	*appEnv = AppEnv{OpenAIPrompt: "ENV_PROMPT", OpenAITemperature: "0.5", OpenAIMaxTokens: "16"}
+
+	config := &AppConfig{Solvers: map[string]SolverConfig{"short": {Type: "openai", MaxTokens: 4}}}
+	solver, err := config.NewSolver("short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := solver.(*OpenAISolver)
+	// config.json wins over the environment
+	if s.Prompt != "ENV_PROMPT" || s.Temperature == nil || *s.Temperature != 0.5 || s.MaxTokens != 4 {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+
+	appEnv.OpenAIMaxTokens = "lots"
+	if _, err := config.NewSolver("openai"); err == nil {
+		t.Fatal("expected error for invalid JTT_OPENAI_MAX_TOKENS")
+	}
+}
+
+func TestIsOpenAIURL(t *testing.T) {
+	tests := []struct {
+		URL  string
+		Want bool
+	}{
+		{DefaultOpenAIBaseURL, true},
+		{"https://api.openai.com/v1/", true},
+		{"https://API.OpenAI.com/v1", true},
+		{"https://api.openai.com:443/v1", true},
+		{"http://localhost:8000/v1", false},
+		{"https://openai.example.org/v1", false},
+		// Can't tell, so assume a key is needed
+		{"api.openai.com/v1", true},
+	}
+	for _, tt := range tests {
+		if got := isOpenAIURL(tt.URL); got != tt.Want {
+			t.Errorf("isOpenAIURL(%q) = %t, want %t", tt.URL, got, tt.Want)
+		}
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	// Pure Go, so jtt still builds with CGO_ENABLED=0 and cross-compiles
+	_ "modernc.org/sqlite"
+)
+
+// Times are stored as fixed-width UTC text, so they sort correctly as strings
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Schema migrations, applied in order; the database's user_version is the number applied so far.
+// Append to this rather than editing a migration that's been released.
+var sqliteMigrations = []string{
+	// One row per crawl, keyed by jail slug and crawl start time. Everything else hangs off a crawl,
+	// and is deleted with it. position columns keep JailTracker's order.
+	// Tables may already exist, from before migrations were tracked.
+	`
+CREATE TABLE IF NOT EXISTS crawls (
+	id INTEGER PRIMARY KEY,
+	jail TEXT NOT NULL,
+	start_time_utc TEXT NOT NULL,
+	-- UTC day of start_time_utc, as YYYY-MM-DD
+	day TEXT NOT NULL,
+	end_time_utc TEXT,
+	base_url TEXT NOT NULL,
+	incomplete INTEGER NOT NULL,
+	captcha_key TEXT NOT NULL,
+	offender_view_key INTEGER NOT NULL,
+	captchas_fetched INTEGER NOT NULL,
+	captchas_solved INTEGER NOT NULL,
+	captcha_solver_errors INTEGER NOT NULL,
+	captchas_rejected_format INTEGER NOT NULL,
+	captchas_rejected_server INTEGER NOT NULL,
+	captchas_accepted INTEGER NOT NULL,
+	prompt_tokens INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	estimated_cost_usd REAL NOT NULL,
+	UNIQUE (jail, start_time_utc)
+);
+CREATE INDEX IF NOT EXISTS crawls_by_day ON crawls (jail, day);
+
+CREATE TABLE IF NOT EXISTS inmates (
+	id INTEGER PRIMARY KEY,
+	crawl_id INTEGER NOT NULL REFERENCES crawls (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	arrest_no TEXT NOT NULL,
+	original_book_date_time TEXT NOT NULL,
+	final_release_date_time TEXT NOT NULL,
+	agency_name TEXT NOT NULL,
+	jacket TEXT NOT NULL,
+	fetch_status TEXT NOT NULL,
+	fetch_attempts INTEGER NOT NULL,
+	fetch_last_error TEXT NOT NULL,
+	fetch_last_error_class TEXT NOT NULL,
+	fetched_at_utc TEXT,
+	UNIQUE (crawl_id, position)
+);
+CREATE INDEX IF NOT EXISTS inmates_by_arrest_no ON inmates (arrest_no);
+
+CREATE TABLE IF NOT EXISTS cases (
+	id INTEGER PRIMARY KEY,
+	inmate_id INTEGER NOT NULL REFERENCES inmates (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	case_no TEXT NOT NULL,
+	status TEXT NOT NULL,
+	bond_type TEXT NOT NULL,
+	bond_amount REAL NOT NULL,
+	fine_amount REAL NOT NULL,
+	sentence TEXT NOT NULL,
+	court_time TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS cases_by_inmate ON cases (inmate_id);
+
+CREATE TABLE IF NOT EXISTS charges (
+	id INTEGER PRIMARY KEY,
+	inmate_id INTEGER NOT NULL REFERENCES inmates (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	"case" TEXT NOT NULL,
+	case_no TEXT NOT NULL,
+	crime_type TEXT NOT NULL,
+	control_number TEXT NOT NULL,
+	warrant_number TEXT NOT NULL,
+	arrest_code TEXT NOT NULL,
+	charge_description TEXT NOT NULL,
+	bond_type TEXT NOT NULL,
+	bond_amount TEXT NOT NULL,
+	court_type TEXT NOT NULL,
+	court_time TEXT NOT NULL,
+	court_name TEXT NOT NULL,
+	charge_status TEXT NOT NULL,
+	offense_date TEXT NOT NULL,
+	arrest_date TEXT NOT NULL,
+	arresting_agency TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS charges_by_inmate ON charges (inmate_id);
+
+-- JailTracker's holds have no known shape, so each is kept as a JSON object
+CREATE TABLE IF NOT EXISTS holds (
+	id INTEGER PRIMARY KEY,
+	inmate_id INTEGER NOT NULL REFERENCES inmates (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS holds_by_inmate ON holds (inmate_id);
+
+-- Labelled as JailTracker labels them, like "Booking Date:". Empty fields are left out.
+CREATE TABLE IF NOT EXISTS special_fields (
+	id INTEGER PRIMARY KEY,
+	inmate_id INTEGER NOT NULL REFERENCES inmates (id) ON DELETE CASCADE,
+	label TEXT NOT NULL,
+	value TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS special_fields_by_inmate ON special_fields (inmate_id);
+`,
+	// Timestamps parsed in the facility's time zone; see Jail.ParseTimes. NULL if unparsed.
+	`
+ALTER TABLE crawls ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE inmates ADD COLUMN original_book_date_time_parsed TEXT;
+ALTER TABLE inmates ADD COLUMN final_release_date_time_parsed TEXT;
+ALTER TABLE cases ADD COLUMN court_time_parsed TEXT;
+ALTER TABLE charges ADD COLUMN court_time_parsed TEXT;
+ALTER TABLE charges ADD COLUMN offense_date_parsed TEXT;
+ALTER TABLE charges ADD COLUMN arrest_date_parsed TEXT;
+ALTER TABLE special_fields ADD COLUMN value_parsed TEXT;
+`,
+	// Amounts in cents and sentences in years, months and days; see Jail.ParseValues. NULL if unparsed.
+	`
+ALTER TABLE cases ADD COLUMN bond_cents INTEGER;
+ALTER TABLE cases ADD COLUMN fine_cents INTEGER;
+ALTER TABLE cases ADD COLUMN sentence_years INTEGER;
+ALTER TABLE cases ADD COLUMN sentence_months INTEGER;
+ALTER TABLE cases ADD COLUMN sentence_days INTEGER;
+ALTER TABLE cases ADD COLUMN sentence_total_days INTEGER;
+ALTER TABLE charges ADD COLUMN bond_cents INTEGER;
+`,
+}
+
+// SQLiteStore keeps snapshots in normalized tables in a SQLite database, for querying across jails and days.
+// Unlike JSONStore, every crawl is kept, even if there are several on the same day.
+type SQLiteStore struct {
+	Path string
+	db   *sql.DB
+}
+
+// OpenSQLiteStore opens the database at dbPath, creating it and its tables if needed.
+func OpenSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(path.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for SQLite database: %w", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	// Jails are saved from several workers at once, but SQLite has one writer at a time anyway
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite tables in %s: %w", dbPath, err)
+	}
+	return &SQLiteStore{Path: dbPath, db: db}, nil
+}
+
+// migrateSQLite applies the migrations the database doesn't have yet, each in its own transaction.
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) String() string {
+	return "sqlite:" + s.Path
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) Where(jail *Jail) string {
+	return fmt.Sprintf("%s (%s, started %s)", s.Path, jail.Name, jail.StartTimeUTC.Format(time.RFC3339))
+}
+
+// Latest returns the jail's most recently started crawl.
+func (s *SQLiteStore) Latest(jailName string) (*Jail, string, error) {
+	return s.find(`SELECT id FROM crawls WHERE jail = ? ORDER BY start_time_utc DESC LIMIT 1`, jailName)
+}
+
+// ForDay returns the jail's latest crawl started on the given UTC day.
+func (s *SQLiteStore) ForDay(jailName string, day time.Time) (*Jail, string, error) {
+	return s.find(`SELECT id FROM crawls WHERE jail = ? AND day = ? ORDER BY start_time_utc DESC LIMIT 1`,
+		jailName, day.UTC().Format(cacheDateFormat))
+}
+
+// find loads the crawl whose ID the query selects.
+func (s *SQLiteStore) find(query string, args ...any) (*Jail, string, error) {
+	var crawlID int64
+	err := s.db.QueryRow(query, args...).Scan(&crawlID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", fmt.Errorf("no snapshot of \"%s\" in %s: %w", args[0], s, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find snapshot: %w", err)
+	}
+	jail, err := s.load(crawlID)
+	if err != nil {
+		return nil, "", err
+	}
+	return jail, s.Where(jail), nil
+}
+
+// Save replaces the crawl with the same jail and start time, if any, in one transaction.
+func (s *SQLiteStore) Save(jail *Jail) error {
+	jail.SchemaVersion = SnapshotVersion
+	jail.logf("Caching jail data in %s", s.Where(jail))
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	// Does nothing once committed
+	defer tx.Rollback()
+
+	start := formatSQLiteTime(jail.StartTimeUTC)
+	if _, err := tx.Exec(`DELETE FROM crawls WHERE jail = ? AND start_time_utc = ?`, jail.Name, start); err != nil {
+		return fmt.Errorf("failed to replace crawl: %w", err)
+	}
+	var end sql.NullString
+	if !jail.EndTimeUTC.IsZero() {
+		end = sql.NullString{String: formatSQLiteTime(jail.EndTimeUTC), Valid: true}
+	}
+	stats := jail.CaptchaStats
+	result, err := tx.Exec(`INSERT INTO crawls (jail, start_time_utc, day, end_time_utc, base_url, incomplete, captcha_key,
+		offender_view_key, captchas_fetched, captchas_solved, captcha_solver_errors, captchas_rejected_format,
+		captchas_rejected_server, captchas_accepted, prompt_tokens, completion_tokens, estimated_cost_usd, time_zone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		jail.Name, start, jail.StartTimeUTC.UTC().Format(cacheDateFormat), end, jail.BaseURL, jail.Incomplete,
+		jail.CaptchaKey, jail.OffenderViewKey, stats.Fetched, stats.Solved, stats.SolverErrors, stats.RejectedFormat,
+		stats.RejectedServer, stats.Accepted, stats.PromptTokens, stats.CompletionTokens, stats.EstimatedCostUSD,
+		jail.TimeZone)
+	if err != nil {
+		return fmt.Errorf("failed to insert crawl: %w", err)
+	}
+	crawlID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert crawl: %w", err)
+	}
+
+	for position := range jail.Inmates {
+		if err := insertInmate(tx, crawlID, position, &jail.Inmates[position]); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit crawl: %w", err)
+	}
+	return nil
+}
+
+// insertInmate inserts an inmate, along with their cases, charges, holds and special fields.
+func insertInmate(tx *sql.Tx, crawlID int64, position int, inmate *Inmate) error {
+	var fetchedAt sql.NullString
+	if inmate.Fetch.FetchedAtUTC != nil {
+		fetchedAt = sql.NullString{String: formatSQLiteTime(*inmate.Fetch.FetchedAtUTC), Valid: true}
+	}
+	result, err := tx.Exec(`INSERT INTO inmates (crawl_id, position, arrest_no, original_book_date_time,
+		final_release_date_time, agency_name, jacket, fetch_status, fetch_attempts, fetch_last_error,
+		fetch_last_error_class, fetched_at_utc, original_book_date_time_parsed, final_release_date_time_parsed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		crawlID, position, inmate.ArrestNo, inmate.OriginalBookDateTime, inmate.FinalReleaseDateTime,
+		inmate.AgencyName, inmate.Jacket, inmate.Fetch.Status, inmate.Fetch.Attempts, inmate.Fetch.LastError,
+		inmate.Fetch.LastErrorClass, fetchedAt, sqliteParsedTime(inmate.Times.OriginalBookDateTime),
+		sqliteParsedTime(inmate.Times.FinalReleaseDateTime))
+	if err != nil {
+		return fmt.Errorf("failed to insert inmate: %w", err)
+	}
+	inmateID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert inmate: %w", err)
+	}
+
+	for i, c := range inmate.Cases {
+		years, months, days, totalDays := sentenceColumns(c.Values.Sentence)
+		_, err := tx.Exec(`INSERT INTO cases (inmate_id, position, case_no, status, bond_type, bond_amount,
+			fine_amount, sentence, court_time, court_time_parsed, bond_cents, fine_cents, sentence_years,
+			sentence_months, sentence_days, sentence_total_days) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			inmateID, i, c.CaseNo, c.Status, c.BondType, c.BondAmount, c.FineAmount, c.Sentence, c.CourtTime,
+			sqliteParsedTime(c.Times.CourtTime), amountCents(c.Values.BondAmount), amountCents(c.Values.FineAmount),
+			years, months, days, totalDays)
+		if err != nil {
+			return fmt.Errorf("failed to insert case: %w", err)
+		}
+	}
+	for i, c := range inmate.Charges {
+		_, err := tx.Exec(`INSERT INTO charges (inmate_id, position, "case", case_no, crime_type, control_number,
+			warrant_number, arrest_code, charge_description, bond_type, bond_amount, court_type, court_time,
+			court_name, charge_status, offense_date, arrest_date, arresting_agency, court_time_parsed,
+			offense_date_parsed, arrest_date_parsed, bond_cents)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			inmateID, i, c.Case, c.CaseNo, c.CrimeType, c.ControlNumber, c.WarrantNumber, c.ArrestCode,
+			c.ChargeDescription, c.BondType, c.BondAmount, c.CourtType, c.CourtTime, c.CourtName, c.ChargeStatus,
+			c.OffenseDate, c.ArrestDate, c.ArrestingAgency, sqliteParsedTime(c.Times.CourtTime),
+			sqliteParsedTime(c.Times.OffenseDate), sqliteParsedTime(c.Times.ArrestDate), amountCents(c.Values.BondAmount))
+		if err != nil {
+			return fmt.Errorf("failed to insert charge: %w", err)
+		}
+	}
+	for i, hold := range inmate.Holds {
+		data, err := json.Marshal(hold)
+		if err != nil {
+			return fmt.Errorf("failed to marshal hold: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO holds (inmate_id, position, data) VALUES (?, ?, ?)`, inmateID, i, string(data)); err != nil {
+			return fmt.Errorf("failed to insert hold: %w", err)
+		}
+	}
+	specialTimes := inmate.specialFieldTimes()
+	for label, value := range inmate.specialFields() {
+		if *value == "" {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO special_fields (inmate_id, label, value, value_parsed) VALUES (?, ?, ?, ?)`,
+			inmateID, label, *value, sqliteParsedTime(specialTimes[label]))
+		if err != nil {
+			return fmt.Errorf("failed to insert special field: %w", err)
+		}
+	}
+	return nil
+}
+
+// load reads a crawl and everything under it.
+func (s *SQLiteStore) load(crawlID int64) (*Jail, error) {
+	// Tables are read into the current struct, whatever version the snapshot was when saved
+	jail := &Jail{SchemaVersion: SnapshotVersion, readVersion: SnapshotVersion}
+	var start string
+	var end sql.NullString
+	stats := &jail.CaptchaStats
+	var timeZone string
+	err := s.db.QueryRow(`SELECT jail, start_time_utc, end_time_utc, base_url, incomplete, captcha_key,
+		offender_view_key, captchas_fetched, captchas_solved, captcha_solver_errors, captchas_rejected_format,
+		captchas_rejected_server, captchas_accepted, prompt_tokens, completion_tokens, estimated_cost_usd, time_zone
+		FROM crawls WHERE id = ?`, crawlID).Scan(
+		&jail.Name, &start, &end, &jail.BaseURL, &jail.Incomplete, &jail.CaptchaKey, &jail.OffenderViewKey,
+		&stats.Fetched, &stats.Solved, &stats.SolverErrors, &stats.RejectedFormat, &stats.RejectedServer,
+		&stats.Accepted, &stats.PromptTokens, &stats.CompletionTokens, &stats.EstimatedCostUSD, &timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crawl: %w", err)
+	}
+	if jail.StartTimeUTC, err = parseSQLiteTime(start); err != nil {
+		return nil, err
+	}
+	if end.Valid {
+		if jail.EndTimeUTC, err = parseSQLiteTime(end.String); err != nil {
+			return nil, err
+		}
+	}
+
+	var inmateIDs []int64
+	err = s.query(`SELECT id, arrest_no, original_book_date_time, final_release_date_time, agency_name, jacket,
+		fetch_status, fetch_attempts, fetch_last_error, fetch_last_error_class, fetched_at_utc
+		FROM inmates WHERE crawl_id = ? ORDER BY position`, crawlID, func(rows *sql.Rows) error {
+		var id int64
+		var inmate Inmate
+		var fetchedAt sql.NullString
+		err := rows.Scan(&id, &inmate.ArrestNo, &inmate.OriginalBookDateTime, &inmate.FinalReleaseDateTime,
+			&inmate.AgencyName, &inmate.Jacket, &inmate.Fetch.Status, &inmate.Fetch.Attempts, &inmate.Fetch.LastError,
+			&inmate.Fetch.LastErrorClass, &fetchedAt)
+		if err != nil {
+			return err
+		}
+		if fetchedAt.Valid {
+			t, err := parseSQLiteTime(fetchedAt.String)
+			if err != nil {
+				return err
+			}
+			inmate.Fetch.FetchedAtUTC = &t
+		}
+		inmateIDs = append(inmateIDs, id)
+		jail.Inmates = append(jail.Inmates, inmate)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inmates: %w", err)
+	}
+	// Inmates by row ID, for attaching their cases and so on
+	inmates := map[int64]*Inmate{}
+	for i, id := range inmateIDs {
+		inmates[id] = &jail.Inmates[i]
+	}
+
+	err = s.query(`SELECT c.inmate_id, c.case_no, c.status, c.bond_type, c.bond_amount, c.fine_amount, c.sentence,
+		c.court_time FROM cases c JOIN inmates i ON c.inmate_id = i.id WHERE i.crawl_id = ? ORDER BY c.inmate_id, c.position`,
+		crawlID, func(rows *sql.Rows) error {
+			var inmateID int64
+			var c Case
+			if err := rows.Scan(&inmateID, &c.CaseNo, &c.Status, &c.BondType, &c.BondAmount, &c.FineAmount, &c.Sentence, &c.CourtTime); err != nil {
+				return err
+			}
+			inmate := inmates[inmateID]
+			inmate.Cases = append(inmate.Cases, c)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cases: %w", err)
+	}
+
+	err = s.query(`SELECT c.inmate_id, c."case", c.case_no, c.crime_type, c.control_number, c.warrant_number,
+		c.arrest_code, c.charge_description, c.bond_type, c.bond_amount, c.court_type, c.court_time, c.court_name,
+		c.charge_status, c.offense_date, c.arrest_date, c.arresting_agency
+		FROM charges c JOIN inmates i ON c.inmate_id = i.id WHERE i.crawl_id = ? ORDER BY c.inmate_id, c.position`,
+		crawlID, func(rows *sql.Rows) error {
+			var inmateID int64
+			var c Charge
+			err := rows.Scan(&inmateID, &c.Case, &c.CaseNo, &c.CrimeType, &c.ControlNumber, &c.WarrantNumber,
+				&c.ArrestCode, &c.ChargeDescription, &c.BondType, &c.BondAmount, &c.CourtType, &c.CourtTime,
+				&c.CourtName, &c.ChargeStatus, &c.OffenseDate, &c.ArrestDate, &c.ArrestingAgency)
+			if err != nil {
+				return err
+			}
+			inmate := inmates[inmateID]
+			inmate.Charges = append(inmate.Charges, c)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read charges: %w", err)
+	}
+
+	err = s.query(`SELECT h.inmate_id, h.data FROM holds h JOIN inmates i ON h.inmate_id = i.id
+		WHERE i.crawl_id = ? ORDER BY h.inmate_id, h.position`, crawlID, func(rows *sql.Rows) error {
+		var inmateID int64
+		var data string
+		if err := rows.Scan(&inmateID, &data); err != nil {
+			return err
+		}
+		var hold Hold
+		if err := json.Unmarshal([]byte(data), &hold); err != nil {
+			return err
+		}
+		inmate := inmates[inmateID]
+		inmate.Holds = append(inmate.Holds, hold)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holds: %w", err)
+	}
+
+	err = s.query(`SELECT f.inmate_id, f.label, f.value FROM special_fields f JOIN inmates i ON f.inmate_id = i.id
+		WHERE i.crawl_id = ?`, crawlID, func(rows *sql.Rows) error {
+		var inmateID int64
+		var label, value string
+		if err := rows.Scan(&inmateID, &label, &value); err != nil {
+			return err
+		}
+		if field, ok := inmates[inmateID].specialFields()[label]; ok {
+			*field = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read special fields: %w", err)
+	}
+
+	// The parsed columns are for queries. Parsing again gives the parse errors too.
+	var loc *time.Location
+	if timeZone != "" {
+		loc, err = time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q in database: %w", timeZone, err)
+		}
+	}
+	jail.Parse(loc)
+	return jail, nil
+}
+
+// query runs a query with one argument, calling f for each row.
+func (s *SQLiteStore) query(query string, arg any, f func(*sql.Rows) error) error {
+	rows, err := s.db.Query(query, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// specialFields maps JailTracker's labels to the inmate's fields for them; see Inmate.update.
+func (i *Inmate) specialFields() map[string]*string {
+	return map[string]*string{
+		"Sched Release:":     &i.SpecialSchedRelease,
+		"Booking Date:":      &i.SpecialBookingDate,
+		"Date Released:":     &i.SpecialDateReleased,
+		"Arrest Date:":       &i.SpecialArrestDate,
+		"Arresting Agency:":  &i.SpecialArrestingAgency,
+		"Arresting Officer:": &i.SpecialArrestingOfficer,
+	}
+}
+
+// specialFieldTimes maps JailTracker's labels to the inmate's parsed times for them, where there are any.
+func (i *Inmate) specialFieldTimes() map[string]*ParsedTime {
+	return map[string]*ParsedTime{
+		"Sched Release:": i.Times.SpecialSchedRelease,
+		"Booking Date:":  i.Times.SpecialBookingDate,
+		"Date Released:": i.Times.SpecialDateReleased,
+		"Arrest Date:":   i.Times.SpecialArrestDate,
+	}
+}
+
+// sqliteParsedTime returns a parsed time for a nullable column.
+func sqliteParsedTime(p *ParsedTime) sql.NullString {
+	if t := parsedTimeValue(p); t != nil {
+		return sql.NullString{String: formatSQLiteTime(*t), Valid: true}
+	}
+	return sql.NullString{}
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func parseSQLiteTime(s string) (time.Time, error) {
+	t, err := time.Parse(sqliteTimeFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q in database: %w", s, err)
+	}
+	return t, nil
+}
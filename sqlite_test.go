@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func openTestSQLiteStore(t *testing.T) *SQLiteStore {
+	store, err := OpenSQLiteStore(path.Join(t.TempDir(), "jtt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	store := openTestSQLiteStore(t)
+	start := time.Date(2024, 7, 16, 23, 30, 0, 123456789, time.UTC)
+	fetched := start.Add(time.Minute)
+	jail := &Jail{
+		Name:            "a",
+		BaseURL:         "https://omsweb.public-safety-cloud.com/jtclientweb/jailtracker/index/A",
+		CaptchaKey:      "key",
+		OffenderViewKey: 7,
+		StartTimeUTC:    start,
+		EndTimeUTC:      start.Add(time.Hour),
+		Incomplete:      true,
+		CaptchaStats:    CaptchaStats{Fetched: 3, Solved: 3, Accepted: 2, RejectedServer: 1, PromptTokens: 10, EstimatedCostUSD: 0.25},
+		Inmates: []Inmate{
+			{
+				ArrestNo:             "1",
+				AgencyName:           "Sheriff",
+				OriginalBookDateTime: "07/16/2024 10:00:00",
+				Cases:                []Case{{CaseNo: "C1", BondAmount: 500, Sentence: "30 days"}},
+				Charges: []Charge{
+					{CaseNo: "C1", ChargeDescription: "Theft", BondAmount: "$500.00"},
+					{CaseNo: "C1", ChargeDescription: "Trespass"},
+				},
+				Holds:              []Hold{{"agency": "ICE"}},
+				SpecialBookingDate: "07/16/2024",
+				Fetch:              InmateFetch{Status: FetchOK, Attempts: 1, FetchedAtUTC: &fetched},
+			},
+			{
+				ArrestNo: "2",
+				Fetch:    InmateFetch{Status: FetchFailed, Attempts: 3, LastError: "timeout", LastErrorClass: "transient"},
+			},
+		},
+	}
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jail.Parse(chicago)
+	if err := store.Save(jail); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := store.Latest("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compared as JSON, which leaves out the jail's logger and other crawl state
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(jail)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Fatalf("snapshot changed in the database.\nGot  %s\nWant %s", gotJSON, wantJSON)
+	}
+	if _, _, err := store.ForDay("a", start); err != nil {
+		t.Fatalf("expected snapshot on its UTC day. Got %v", err)
+	}
+	if _, _, err := store.ForDay("a", start.Add(time.Hour)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist the next UTC day. Got %v", err)
+	}
+	if _, _, err := store.Latest("b"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for another jail. Got %v", err)
+	}
+}
+
+func TestSQLiteStoreKeepsEveryCrawl(t *testing.T) {
+	store := openTestSQLiteStore(t)
+	morning := time.Date(2024, 7, 16, 8, 0, 0, 0, time.UTC)
+	evening := morning.Add(10 * time.Hour)
+	for _, jail := range []*Jail{
+		{Name: "a", StartTimeUTC: morning, Incomplete: true, Inmates: []Inmate{{ArrestNo: "1"}}},
+		{Name: "a", StartTimeUTC: evening, Inmates: []Inmate{{ArrestNo: "1"}, {ArrestNo: "2"}}},
+		// A checkpoint of the morning crawl replaces it, rather than adding another
+		{Name: "a", StartTimeUTC: morning, Inmates: []Inmate{{ArrestNo: "1"}, {ArrestNo: "3"}}},
+	} {
+		if err := store.Save(jail); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var crawls, inmates int
+	if err := store.db.QueryRow(`SELECT count(*) FROM crawls`).Scan(&crawls); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.QueryRow(`SELECT count(*) FROM inmates`).Scan(&inmates); err != nil {
+		t.Fatal(err)
+	}
+	if crawls != 2 || inmates != 4 {
+		t.Fatalf("expected 2 crawls of 4 inmates. Got %d crawls of %d inmates", crawls, inmates)
+	}
+	jail, _, err := store.ForDay("a", morning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jail.StartTimeUTC.Equal(evening) {
+		t.Fatalf("expected the day's latest crawl. Got one from %v", jail.StartTimeUTC)
+	}
+}
+
+func TestLoadJailCachedSQLite(t *testing.T) {
+	store := openTestSQLiteStore(t)
+	if err := store.Save(&Jail{Name: "a", StartTimeUTC: time.Now().Add(-72 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	// No BaseURL, so any request would fail
+	jail, err := LoadJailCached(context.Background(), store, &JailConfig{Slug: "a", Usable: true}, CachePolicy{Mode: CacheOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jail.cached {
+		t.Fatal("expected the cached snapshot")
+	}
+}
+
+func TestSQLiteStoreMigratesOldDatabase(t *testing.T) {
+	// A database from before migrations were tracked, with the first migration's tables and user_version 0
+	dbPath := path.Join(t.TempDir(), "jtt.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sqliteMigrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := OpenSQLiteStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var version int
+	if err := store.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != len(sqliteMigrations) {
+		t.Fatalf("expected every migration applied. Got version %d, %v", version, err)
+	}
+	var foreignKeys int
+	var journalMode string
+	if err := store.db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+		t.Fatalf("expected foreign keys enforced. Got %d, %v", foreignKeys, err)
+	}
+	if err := store.db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Fatalf("expected WAL mode. Got %q, %v", journalMode, err)
+	}
+	jail := &Jail{Name: "a", StartTimeUTC: time.Now(), Inmates: []Inmate{{
+		OriginalBookDateTime: "6/28/2024T10:22:44",
+		Cases:                []Case{{FineAmount: 25.5}},
+		Charges:              []Charge{{BondAmount: "$1,500.00"}},
+	}}}
+	jail.Parse(time.UTC)
+	if err := store.Save(jail); err != nil {
+		t.Fatal(err)
+	}
+	var booked string
+	if err := store.db.QueryRow(`SELECT original_book_date_time_parsed FROM inmates`).Scan(&booked); err != nil {
+		t.Fatal(err)
+	}
+	if booked != "2024-06-28T10:22:44.000000000Z" {
+		t.Fatalf("unexpected parsed booking time %q", booked)
+	}
+	var fineCents, bondCents int64
+	var sentenceDays sql.NullInt64
+	err = store.db.QueryRow(`SELECT c.fine_cents, c.sentence_total_days, h.bond_cents FROM cases c, charges h`).
+		Scan(&fineCents, &sentenceDays, &bondCents)
+	if err != nil || fineCents != 2550 || bondCents != 150000 || sentenceDays.Valid {
+		t.Fatalf("unexpected parsed amounts. Got fine %d, bond %d, sentence %v, %v", fineCents, bondCents, sentenceDays, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// Storage backends, set by AppConfig.Storage
+const (
+	StorageJSON   = "json"
+	StorageSQLite = "sqlite"
+)
+
+// Default SQLite database, under the cache directory, unless AppConfig.SQLitePath says otherwise
+const defaultSQLiteName = "jtt.db"
+
+// SnapshotStore saves and loads jail snapshots. Snapshots are identified by jail name and crawl start time.
+// Methods that return a snapshot also return where it's stored, for logs.
+type SnapshotStore interface {
+	// Latest returns the jail's most recent snapshot. If there's none, the error wraps os.ErrNotExist.
+	// If it's unreadable, the error wraps errCorruptSnapshot.
+	Latest(jailName string) (*Jail, string, error)
+	// ForDay returns the jail's latest snapshot from the given UTC day. If there's none, the error wraps os.ErrNotExist.
+	ForDay(jailName string, day time.Time) (*Jail, string, error)
+	// Save stores a snapshot, replacing any earlier save of the same crawl.
+	Save(jail *Jail) error
+	// Where returns where Save would store the snapshot.
+	Where(jail *Jail) string
+	// String describes the store, like "./cache" or "sqlite:./cache/jtt.db".
+	String() string
+	Close() error
+}
+
+// quarantiner is implemented by stores that can move corrupt snapshots aside; see latestValidJail.
+// The location is as returned by Latest.
+type quarantiner interface {
+	Quarantine(location string) (string, error)
+}
+
+// parseStorage checks a storage backend from the config or command line. Empty means StorageJSON.
+func parseStorage(s string) (string, error) {
+	switch s {
+	case "":
+		return StorageJSON, nil
+	case StorageJSON, StorageSQLite:
+		return s, nil
+	default:
+		return "", fmt.Errorf(`unknown storage "%s"; expected %s or %s`, s, StorageJSON, StorageSQLite)
+	}
+}
+
+// OpenStore opens the configured snapshot store. Close it when done.
+func (config *AppConfig) OpenStore() (SnapshotStore, error) {
+	storage, err := parseStorage(config.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if storage == StorageSQLite {
+		dbPath := config.SQLitePath
+		if dbPath == "" {
+			dbPath = path.Join(config.Cache, defaultSQLiteName)
+		}
+		return OpenSQLiteStore(dbPath)
+	}
+	compression, err := config.SnapshotCompression()
+	if err != nil {
+		return nil, err
+	}
+	return &JSONStore{Dir: config.Cache, Compression: compression}, nil
+}
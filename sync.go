@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// runSync implements `jtt sync`, which pushes cached snapshots to the shared Postgres database.
+// Snapshots already pushed unchanged are skipped, so running it again is cheap.
+func runSync(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	filter := &JailFilter{}
+	filter.addFlags(flags)
+	addCacheFlag(flags)
+	addStorageFlag(flags)
+	dsn := flags.String("dsn", appEnv.PostgresDSN, "Postgres database to push to (default from JTT_POSTGRES_DSN)")
+	date := flags.String("date", "", "UTC day of the snapshots, as YYYY-MM-DD (default each jail's latest)")
+	since := flags.String("since", "", "push each day's snapshot from this UTC day, as YYYY-MM-DD, through today")
+	force := flags.Bool("force", false, "push snapshots even if they were already pushed unchanged")
+	dryRun := flags.Bool("dry-run", false, "list the snapshots that would be pushed, without changing the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		return errors.New("no database to sync to; set JTT_POSTGRES_DSN or pass -dsn")
+	}
+	if *date != "" && *since != "" {
+		return errors.New("-date and -since can't be used together")
+	}
+	days, err := syncDays(*date, *since, time.Now())
+	if err != nil {
+		return err
+	}
+	jailConfigs, err := filter.Select(appConfig)
+	if err != nil {
+		return err
+	}
+	store, err := appConfig.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	target, err := OpenPostgresTarget(*dsn)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	// A dry run leaves even the schema alone. Without it, nothing has been pushed yet.
+	hasSchema := true
+	if *dryRun {
+		if hasSchema, err = target.HasSchema(); err != nil {
+			return fmt.Errorf("failed to check for jtt schema: %w", err)
+		}
+	} else {
+		applied, err := target.Migrate()
+		for _, name := range applied {
+			log.Printf("Applied migration %s", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var pushed, unchanged, skipped, inmates int
+	for _, jailConfig := range jailConfigs {
+		for _, day := range days {
+			jail, location, err := syncSnapshot(store, jailConfig.Slug, day)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if errors.Is(err, errCorruptSnapshot) {
+				log.Printf("Skipping %v", err)
+				skipped++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// So the parsed time columns are filled in, however old the snapshot
+			parseFor(jail, jailConfig)
+			hash, err := snapshotHash(jail)
+			if err != nil {
+				return err
+			}
+			if hasSchema && !*force {
+				done, err := target.Pushed(jail, hash)
+				if err != nil {
+					return err
+				}
+				if done {
+					unchanged++
+					continue
+				}
+			}
+			if *dryRun {
+				fmt.Println(location)
+			} else {
+				jail.logf("Pushing %d inmates from %s", len(jail.Inmates), location)
+				if err := target.Push(jail, hash); err != nil {
+					return fmt.Errorf("failed to push %s: %w", location, err)
+				}
+			}
+			pushed++
+			inmates += len(jail.Inmates)
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Would push %d snapshots (%d inmates). %d already pushed unchanged.", pushed, inmates, unchanged)
+		return nil
+	}
+	log.Printf("Pushed %d snapshots (%d inmates). %d already pushed unchanged, %d corrupt skipped.",
+		pushed, inmates, unchanged, skipped)
+	return nil
+}
+
+// syncDays returns the UTC days to push, from the -date or -since flag.
+// A nil day stands for each jail's latest snapshot.
+func syncDays(date, since string, now time.Time) ([]*time.Time, error) {
+	if date != "" {
+		day, err := parseDay(date)
+		if err != nil {
+			return nil, err
+		}
+		return []*time.Time{&day}, nil
+	}
+	if since == "" {
+		return []*time.Time{nil}, nil
+	}
+	start, err := parseDay(since)
+	if err != nil {
+		return nil, err
+	}
+	var days []*time.Time
+	for day := start; !day.After(now.UTC()); day = day.AddDate(0, 0, 1) {
+		day := day
+		days = append(days, &day)
+	}
+	return days, nil
+}
+
+// syncSnapshot reads a jail's snapshot for the day, or its latest if day is nil.
+func syncSnapshot(store SnapshotStore, slug string, day *time.Time) (*Jail, string, error) {
+	if day == nil {
+		return store.Latest(slug)
+	}
+	return store.ForDay(slug, *day)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParsedTime is a timestamp from JailTracker, parsed in the facility's time zone.
+// JailTracker sends timestamps as text, in different formats for different fields and facilities.
+type ParsedTime struct {
+	Raw string `json:"raw"`
+	// Unset if Raw couldn't be parsed
+	Time *time.Time `json:"time,omitempty"`
+	// Why Raw couldn't be parsed
+	Error string `json:"error,omitempty"`
+	// Set if Raw had no time of day, so Time is midnight
+	DateOnly bool `json:"dateOnly,omitempty"`
+}
+
+// Formats seen from JailTracker, tried in order. Runs of spaces are collapsed before parsing,
+// since some facilities pad like SQL Server does ("Jul  1 2024  9:00AM").
+var jailTimeLayouts = []struct {
+	Layout   string
+	DateOnly bool
+}{
+	{"1/2/2006T15:04:05", false},   // OriginalBookDateTime: "6/28/2024T10:22:44"
+	{"1/2/2006 3:04:05 PM", false}, // SpecialBookingDate: "6/28/2024 10:22:44 AM"
+	{"1/2/2006 3:04 PM", false},
+	{"1/2/2006 15:04:05", false},
+	{"1/2/2006 15:04", false},
+	{"Jan 2 2006 3:04PM", false}, // CourtTime: "Jul 10 2024 9:00AM"
+	{"Jan 2 2006 3:04 PM", false},
+	{"2006-01-02T15:04:05", false},
+	{"2006-01-02 15:04:05", false},
+	{"1/2/2006", true},   // SpecialArrestDate: "6/28/2024"
+	{"2006-01-02", true}, // OffenseDate: "2024-06-28"
+}
+
+// parseJailTime parses a JailTracker timestamp in the facility's time zone.
+// Empty values return nil, since there's nothing to parse.
+func parseJailTime(raw string, loc *time.Location) *ParsedTime {
+	value := strings.Join(strings.Fields(raw), " ")
+	if value == "" {
+		return nil
+	}
+	for _, format := range jailTimeLayouts {
+		t, err := time.ParseInLocation(format.Layout, value, loc)
+		if err == nil {
+			return &ParsedTime{Raw: raw, Time: &t, DateOnly: format.DateOnly}
+		}
+	}
+	return &ParsedTime{Raw: raw, Error: fmt.Sprintf("unrecognized time format %q", raw)}
+}
+
+// InmateTimes holds an inmate's timestamps, parsed from the raw fields of the same names.
+type InmateTimes struct {
+	OriginalBookDateTime *ParsedTime `json:"originalBookDateTime,omitempty"`
+	FinalReleaseDateTime *ParsedTime `json:"finalReleaseDateTime,omitempty"`
+	SpecialSchedRelease  *ParsedTime `json:"specialSchedRelease,omitempty"`
+	SpecialBookingDate   *ParsedTime `json:"specialBookingDate,omitempty"`
+	SpecialDateReleased  *ParsedTime `json:"specialDateReleased,omitempty"`
+	SpecialArrestDate    *ParsedTime `json:"specialArrestDate,omitempty"`
+}
+
+// CaseTimes holds a case's timestamps, parsed from the raw fields of the same names.
+type CaseTimes struct {
+	CourtTime *ParsedTime `json:"courtTime,omitempty"`
+}
+
+// ChargeTimes holds a charge's timestamps, parsed from the raw fields of the same names.
+type ChargeTimes struct {
+	CourtTime   *ParsedTime `json:"courtTime,omitempty"`
+	OffenseDate *ParsedTime `json:"offenseDate,omitempty"`
+	ArrestDate  *ParsedTime `json:"arrestDate,omitempty"`
+}
+
+// ParseTimes parses every inmate's timestamps in the facility's time zone, replacing any parsed before.
+// It's called whenever a jail is saved or loaded for a crawl, so older snapshots and those parsed in
+// a since-corrected time zone are brought up to date. With no time zone, nothing is parsed.
+func (j *Jail) ParseTimes(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	j.TimeZone = loc.String()
+	for i := range j.Inmates {
+		inmate := &j.Inmates[i]
+		inmate.Times = InmateTimes{
+			OriginalBookDateTime: parseJailTime(inmate.OriginalBookDateTime, loc),
+			FinalReleaseDateTime: parseJailTime(inmate.FinalReleaseDateTime, loc),
+			SpecialSchedRelease:  parseJailTime(inmate.SpecialSchedRelease, loc),
+			SpecialBookingDate:   parseJailTime(inmate.SpecialBookingDate, loc),
+			SpecialDateReleased:  parseJailTime(inmate.SpecialDateReleased, loc),
+			SpecialArrestDate:    parseJailTime(inmate.SpecialArrestDate, loc),
+		}
+		for k := range inmate.Cases {
+			c := &inmate.Cases[k]
+			c.Times = CaseTimes{CourtTime: parseJailTime(c.CourtTime, loc)}
+		}
+		for k := range inmate.Charges {
+			c := &inmate.Charges[k]
+			c.Times = ChargeTimes{
+				CourtTime:   parseJailTime(c.CourtTime, loc),
+				OffenseDate: parseJailTime(c.OffenseDate, loc),
+				ArrestDate:  parseJailTime(c.ArrestDate, loc),
+			}
+		}
+	}
+}
+
+// parsedTimeValue returns the parsed time, or nil if there's none, for storing in a nullable column.
+func parsedTimeValue(p *ParsedTime) *time.Time {
+	if p == nil {
+		return nil
+	}
+	return p.Time
+}
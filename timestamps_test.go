@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJailTime(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Raw      string
+		Want     time.Time
+		DateOnly bool
+	}{
+		{"6/28/2024T10:22:44", time.Date(2024, 6, 28, 10, 22, 44, 0, chicago), false},
+		{"6/28/2024 10:22:44 AM", time.Date(2024, 6, 28, 10, 22, 44, 0, chicago), false},
+		{"6/28/2024 10:22:44 PM", time.Date(2024, 6, 28, 22, 22, 44, 0, chicago), false},
+		{"Jul 10 2024 9:00AM", time.Date(2024, 7, 10, 9, 0, 0, 0, chicago), false},
+		{"Jul  1 2024  9:00AM", time.Date(2024, 7, 1, 9, 0, 0, 0, chicago), false},
+		{"2024-06-28", time.Date(2024, 6, 28, 0, 0, 0, 0, chicago), true},
+		{"06/28/2024", time.Date(2024, 6, 28, 0, 0, 0, 0, chicago), true},
+		// Standard time, five hours behind UTC rather than six
+		{"1/5/2024T08:00:00", time.Date(2024, 1, 5, 14, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Raw, func(t *testing.T) {
+			got := parseJailTime(tt.Raw, chicago)
+			if got == nil || got.Time == nil {
+				t.Fatalf("expected %q to parse. Got %+v", tt.Raw, got)
+			}
+			if !got.Time.Equal(tt.Want) || got.DateOnly != tt.DateOnly || got.Raw != tt.Raw {
+				t.Fatalf("unexpected parse of %q. Got %v (date only: %t)", tt.Raw, got.Time, got.DateOnly)
+			}
+		})
+	}
+
+	if got := parseJailTime("  ", chicago); got != nil {
+		t.Fatalf("expected nil for a blank time. Got %+v", got)
+	}
+	got := parseJailTime("sometime soon", chicago)
+	if got == nil || got.Time != nil || got.Error == "" || got.Raw != "sometime soon" {
+		t.Fatalf("expected a parse error, keeping the raw value. Got %+v", got)
+	}
+}
+
+func TestJailConfigLocation(t *testing.T) {
+	tests := []struct {
+		Config  JailConfig
+		Want    string
+		WantErr bool
+	}{
+		{JailConfig{State: "MS"}, "America/Chicago", false},
+		{JailConfig{State: " ga "}, "America/New_York", false},
+		// Western Kentucky is on Central time, so Kentucky's jails have to say which zone they're in
+		{JailConfig{State: "KY"}, "", true},
+		{JailConfig{State: "KY", TimeZone: "America/Chicago"}, "America/Chicago", false},
+		{JailConfig{State: "Mississippi"}, "", true},
+		{JailConfig{TimeZone: "Gulf/Biloxi"}, "", true},
+	}
+	for _, tt := range tests {
+		loc, err := tt.Config.Location()
+		if (err != nil) != tt.WantErr {
+			t.Errorf("unexpected error for %+v: %v", tt.Config, err)
+			continue
+		}
+		if err == nil && loc.String() != tt.Want {
+			t.Errorf("unexpected zone for %+v. Got %s, want %s", tt.Config, loc, tt.Want)
+		}
+	}
+}
+
+func TestJailParseTimes(t *testing.T) {
+	jail := &Jail{Inmates: []Inmate{{
+		OriginalBookDateTime: "6/28/2024T10:22:44",
+		SpecialArrestDate:    "6/28/2024",
+		Cases:                []Case{{CourtTime: "Jul 10 2024 9:00AM"}},
+		Charges:              []Charge{{OffenseDate: "2024-06-28", CourtTime: "TBD"}},
+	}}}
+	jail.ParseTimes(nil)
+	if jail.TimeZone != "" || jail.Inmates[0].Times.OriginalBookDateTime != nil {
+		t.Fatal("expected nothing parsed without a time zone")
+	}
+
+	loc, _ := time.LoadLocation("America/Chicago")
+	jail.ParseTimes(loc)
+	inmate := jail.Inmates[0]
+	if jail.TimeZone != "America/Chicago" {
+		t.Fatalf("unexpected time zone %q", jail.TimeZone)
+	}
+	if inmate.Times.OriginalBookDateTime.Time == nil || !inmate.Times.SpecialArrestDate.DateOnly {
+		t.Fatalf("unexpected inmate times: %+v", inmate.Times)
+	}
+	if inmate.Times.FinalReleaseDateTime != nil {
+		t.Fatal("expected no parsed release time, since there's no raw one")
+	}
+	if inmate.Cases[0].Times.CourtTime.Time == nil || inmate.Charges[0].Times.OffenseDate.Time == nil {
+		t.Fatal("expected case and charge times to be parsed")
+	}
+	if inmate.Charges[0].Times.CourtTime.Error == "" {
+		t.Fatal("expected a parse error for the charge's court time")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Facilities' zones shouldn't depend on the host having tzdata installed
+	_ "time/tzdata"
+)
+
+// Time zone of each state that's in only one, by postal code
+var stateTimeZones = map[string]string{
+	"AL": "America/Chicago",
+	"AR": "America/Chicago",
+	"CA": "America/Los_Angeles",
+	"CO": "America/Denver",
+	"CT": "America/New_York",
+	"DC": "America/New_York",
+	"DE": "America/New_York",
+	"GA": "America/New_York",
+	"HI": "Pacific/Honolulu",
+	"IA": "America/Chicago",
+	"IL": "America/Chicago",
+	"LA": "America/Chicago",
+	"MA": "America/New_York",
+	"MD": "America/New_York",
+	"ME": "America/New_York",
+	"MN": "America/Chicago",
+	"MO": "America/Chicago",
+	"MS": "America/Chicago",
+	"MT": "America/Denver",
+	"NC": "America/New_York",
+	"NH": "America/New_York",
+	"NJ": "America/New_York",
+	"NM": "America/Denver",
+	"NV": "America/Los_Angeles",
+	"NY": "America/New_York",
+	"OH": "America/New_York",
+	"OK": "America/Chicago",
+	"PA": "America/New_York",
+	"RI": "America/New_York",
+	"SC": "America/New_York",
+	"UT": "America/Denver",
+	"VA": "America/New_York",
+	"VT": "America/New_York",
+	"WA": "America/Los_Angeles",
+	"WI": "America/Chicago",
+	"WV": "America/New_York",
+	"WY": "America/Denver",
+}
+
+// States split across time zones, or across observing daylight saving time (the Navajo Nation in Arizona).
+// Guessing a zone for facilities in these would silently shift their times by an hour, so they must set JailConfig.TimeZone.
+var splitTimeZoneStates = map[string]bool{
+	"AK": true,
+	"AZ": true,
+	"FL": true,
+	"ID": true,
+	"IN": true,
+	"KS": true,
+	"KY": true,
+	"MI": true,
+	"ND": true,
+	"NE": true,
+	"OR": true,
+	"SD": true,
+	"TN": true,
+	"TX": true,
+}
+
+// Location returns the facility's time zone: TimeZone if set, or else the zone of its State,
+// unless the State spans several zones.
+func (jailConfig *JailConfig) Location() (*time.Location, error) {
+	if jailConfig.TimeZone != "" {
+		loc, err := time.LoadLocation(jailConfig.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("jail \"%s\" has an invalid TimeZone: %w", jailConfig.Slug, err)
+		}
+		return loc, nil
+	}
+	state := strings.ToUpper(strings.TrimSpace(jailConfig.State))
+	if splitTimeZoneStates[state] {
+		return nil, fmt.Errorf("jail \"%s\" has no TimeZone, and State \"%s\" spans several time zones", jailConfig.Slug, jailConfig.State)
+	}
+	name, ok := stateTimeZones[state]
+	if !ok {
+		return nil, fmt.Errorf("jail \"%s\" has no TimeZone, and no time zone is known for State \"%s\"", jailConfig.Slug, jailConfig.State)
+	}
+	return time.LoadLocation(name)
+}
+
+// parseFor parses a jail's amounts and sentences, and its timestamps in the facility's time zone if it's known.
+// Validate reports jails whose zone isn't.
+func parseFor(jail *Jail, jailConfig *JailConfig) {
+	loc, _ := jailConfig.Location()
+	jail.Parse(loc)
+}
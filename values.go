@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsedAmount is a dollar amount from JailTracker, like a bond or fine, in exact cents.
+// Charges send amounts as text ("0.00", sometimes "$1,500.00"), and cases as numbers.
+type ParsedAmount struct {
+	Raw string `json:"raw"`
+	// Unset if Raw couldn't be parsed
+	Cents *int64 `json:"cents,omitempty"`
+	// Why Raw couldn't be parsed
+	Error string `json:"error,omitempty"`
+}
+
+var amountPattern = regexp.MustCompile(`^(-?)\$?(\d*)(?:\.(\d*))?$`)
+
+// parseAmount parses a dollar amount into cents, without going through floating point.
+// Empty values return nil, since there's nothing to parse.
+func parseAmount(raw string) *ParsedAmount {
+	value := strings.ReplaceAll(strings.TrimSpace(raw), ",", "")
+	if value == "" {
+		return nil
+	}
+	fail := func(reason string) *ParsedAmount {
+		return &ParsedAmount{Raw: raw, Error: fmt.Sprintf("%s: %q", reason, raw)}
+	}
+	match := amountPattern.FindStringSubmatch(value)
+	if match == nil || match[2]+match[3] == "" {
+		return fail("unrecognized amount")
+	}
+	dollars, cents := match[2], match[3]
+	// Fractions of a cent are only fine if they're zero, like "12.5000"
+	if len(cents) > 2 {
+		if strings.Trim(cents[2:], "0") != "" {
+			return fail("amount has fractions of a cent")
+		}
+		cents = cents[:2]
+	}
+	// Up to about $9 trillion fits in int64 cents
+	if len(strings.TrimLeft(dollars, "0")) > 16 {
+		return fail("amount is too large")
+	}
+	total, err := strconv.ParseInt(dollars+(cents + "00")[:2], 10, 64)
+	if err != nil {
+		return fail("amount is too large")
+	}
+	if match[1] == "-" {
+		total = -total
+	}
+	return &ParsedAmount{Raw: raw, Cents: &total}
+}
+
+// parseAmountNumber parses an amount JailTracker sent as a number.
+// These can't tell a missing amount from zero, so zero is parsed as zero.
+func parseAmountNumber(value float64) *ParsedAmount {
+	return parseAmount(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// ParsedSentence is a case's sentence, parsed from JailTracker's "0y 0m 0d" text.
+// A case with no sentence at all has no ParsedSentence, unlike a sentence of "0y 0m 0d".
+type ParsedSentence struct {
+	Raw string `json:"raw"`
+	// Unset if Raw couldn't be parsed
+	Term *SentenceTerm `json:"term,omitempty"`
+	// Why Raw couldn't be parsed
+	Error string `json:"error,omitempty"`
+}
+
+// SentenceTerm is the length of a sentence, as given.
+type SentenceTerm struct {
+	Years  int `json:"years"`
+	Months int `json:"months"`
+	Days   int `json:"days"`
+	// An approximation for comparing and summing sentences, counting years as 365 days and months as 30
+	TotalDays int `json:"totalDays"`
+}
+
+var sentencePartPattern = regexp.MustCompile(`(\d+)\s*(years?|yrs?|y|months?|mos?|m|days?|d)\b`)
+
+// parseSentence parses a sentence like "1y 6m 0d", "2 years" or "30 days".
+// Empty values return nil, since there's no sentence.
+func parseSentence(raw string) *ParsedSentence {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	if value == "" {
+		return nil
+	}
+	fail := func(reason string) *ParsedSentence {
+		return &ParsedSentence{Raw: raw, Error: fmt.Sprintf("%s: %q", reason, raw)}
+	}
+	var term SentenceTerm
+	seen := map[byte]bool{}
+	end := 0
+	for _, match := range sentencePartPattern.FindAllStringSubmatchIndex(value, -1) {
+		// Only spaces and commas may come between parts
+		if strings.Trim(value[end:match[0]], " ,") != "" {
+			return fail("unrecognized sentence")
+		}
+		end = match[1]
+		n, err := strconv.Atoi(value[match[2]:match[3]])
+		if err != nil {
+			return fail("sentence is too long")
+		}
+		unit := value[match[4]]
+		if seen[unit] {
+			return fail("sentence repeats a unit")
+		}
+		seen[unit] = true
+		switch unit {
+		case 'y':
+			term.Years = n
+		case 'm':
+			term.Months = n
+		case 'd':
+			term.Days = n
+		}
+	}
+	if end == 0 || strings.Trim(value[end:], " ,") != "" {
+		return fail("unrecognized sentence")
+	}
+	term.TotalDays = term.Years*365 + term.Months*30 + term.Days
+	return &ParsedSentence{Raw: raw, Term: &term}
+}
+
+// CaseValues holds a case's amounts and sentence, parsed from the raw fields of the same names.
+type CaseValues struct {
+	BondAmount *ParsedAmount   `json:"bondAmount,omitempty"`
+	FineAmount *ParsedAmount   `json:"fineAmount,omitempty"`
+	Sentence   *ParsedSentence `json:"sentence,omitempty"`
+}
+
+// ChargeValues holds a charge's amounts, parsed from the raw fields of the same names.
+type ChargeValues struct {
+	BondAmount *ParsedAmount `json:"bondAmount,omitempty"`
+}
+
+// ParseValues parses every case's and charge's amounts and sentence, replacing any parsed before.
+func (j *Jail) ParseValues() {
+	for i := range j.Inmates {
+		inmate := &j.Inmates[i]
+		for k := range inmate.Cases {
+			c := &inmate.Cases[k]
+			c.Values = CaseValues{
+				BondAmount: parseAmountNumber(c.BondAmount),
+				FineAmount: parseAmountNumber(c.FineAmount),
+				Sentence:   parseSentence(c.Sentence),
+			}
+		}
+		for k := range inmate.Charges {
+			c := &inmate.Charges[k]
+			c.Values = ChargeValues{BondAmount: parseAmount(c.BondAmount)}
+		}
+	}
+}
+
+// Parse parses a jail's amounts and sentences, and its timestamps in the facility's time zone.
+// With no time zone, timestamps are left unparsed.
+func (j *Jail) Parse(loc *time.Location) {
+	j.ParseValues()
+	j.ParseTimes(loc)
+}
+
+// amountCents returns the parsed amount, or NULL if there's none, for storing in a nullable column.
+func amountCents(p *ParsedAmount) sql.NullInt64 {
+	if p == nil || p.Cents == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *p.Cents, Valid: true}
+}
+
+// sentenceColumns returns the parsed sentence's years, months, days and total days,
+// or NULLs if there's none, for storing in nullable columns.
+func sentenceColumns(p *ParsedSentence) (years, months, days, totalDays sql.NullInt64) {
+	if p == nil || p.Term == nil {
+		return
+	}
+	column := func(n int) sql.NullInt64 {
+		return sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+	return column(p.Term.Years), column(p.Term.Months), column(p.Term.Days), column(p.Term.TotalDays)
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		Raw     string
+		Want    int64
+		WantErr bool
+	}{
+		{"0.00", 0, false},
+		{"1500.00", 150000, false},
+		{"$1,500.00", 150000, false},
+		{" 250 ", 25000, false},
+		{"12.5", 1250, false},
+		{".99", 99, false},
+		{"-10.01", -1001, false},
+		{"12.5000", 1250, false},
+		// Amounts that floating point can't hold exactly
+		{"0.29", 29, false},
+		{"1234567.89", 123456789, false},
+		{"12.345", 0, true},
+		{"N/A", 0, true},
+		{"$", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		got := parseAmount(tt.Raw)
+		if got == nil || got.Raw != tt.Raw {
+			t.Errorf("expected %q parsed, keeping the raw value. Got %+v", tt.Raw, got)
+			continue
+		}
+		if tt.WantErr {
+			if got.Cents != nil || got.Error == "" {
+				t.Errorf("expected an error for %q. Got %+v", tt.Raw, got)
+			}
+			continue
+		}
+		if got.Cents == nil || *got.Cents != tt.Want {
+			t.Errorf("unexpected parse of %q. Got %+v, want %d cents", tt.Raw, got, tt.Want)
+		}
+	}
+	if got := parseAmount(""); got != nil {
+		t.Fatalf("expected nil for no amount. Got %+v", got)
+	}
+	if got := parseAmountNumber(0.29); got.Cents == nil || *got.Cents != 29 {
+		t.Fatalf("unexpected parse of 0.29. Got %+v", got)
+	}
+}
+
+func TestParseSentence(t *testing.T) {
+	tests := []struct {
+		Raw     string
+		Want    SentenceTerm
+		WantErr bool
+	}{
+		{"0y 0m 0d", SentenceTerm{}, false},
+		{"1y 6m 15d", SentenceTerm{Years: 1, Months: 6, Days: 15, TotalDays: 560}, false},
+		{"30 days", SentenceTerm{Days: 30, TotalDays: 30}, false},
+		{"2 Years, 3 Months", SentenceTerm{Years: 2, Months: 3, TotalDays: 820}, false},
+		{"LIFE", SentenceTerm{}, true},
+		{"1y 2y", SentenceTerm{}, true},
+		{"1y then 2m", SentenceTerm{}, true},
+		{"5", SentenceTerm{}, true},
+	}
+	for _, tt := range tests {
+		got := parseSentence(tt.Raw)
+		if got == nil || got.Raw != tt.Raw {
+			t.Errorf("expected %q parsed, keeping the raw value. Got %+v", tt.Raw, got)
+			continue
+		}
+		if tt.WantErr {
+			if got.Term != nil || got.Error == "" {
+				t.Errorf("expected an error for %q. Got %+v", tt.Raw, got)
+			}
+			continue
+		}
+		if got.Term == nil || *got.Term != tt.Want {
+			t.Errorf("unexpected parse of %q. Got %+v, want %+v", tt.Raw, got.Term, tt.Want)
+		}
+	}
+	// No sentence is different from a sentence of zero
+	if got := parseSentence(" "); got != nil {
+		t.Fatalf("expected nil for no sentence. Got %+v", got)
+	}
+}